@@ -1,52 +1,143 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gdamore/tcell"
-	"github.com/orcaman/concurrent-map"
 	"github.com/rivo/tview"
 
+	usData "UsedSpace/usData"
+	usExport "UsedSpace/usExport"
+	usReport "UsedSpace/usReport"
 	usUI "UsedSpace/usUI"
 	usWalk "UsedSpace/usWalk"
 )
 
 // Create the application instance, all main components, start the app and directory scan in parallel
 func main() {
-	givenPath, _ := os.Getwd() // Without arguments, scan the current directory
-	if len(os.Args) > 2 {
-		panic("Too much arguments!!")
-	} else {
-		if len(os.Args) == 2 {
-			givenPath = os.Args[1]
-			latestChar := givenPath[len(givenPath)-1:]
+	// Command line options
+	oneFileSystem := flag.Bool("x", false, "stay on the filesystem of the scanned directory (don't cross mount points)")
+	flag.BoolVar(oneFileSystem, "one-file-system", false, "same as -x")
+	report := flag.Bool("report", false, "print the size tree to stdout and exit, without the interactive interface")
+	reportTop := flag.Int("top", 10, "report: number of largest entries printed per directory (0 for all)")
+	reportDepth := flag.Int("depth", 1, "report: number of directory levels printed under the scanned directory")
+	reportBytes := flag.Bool("bytes", false, "report: print sizes in bytes instead of human readable units")
+	reportDiskSize := flag.Bool("disk-usage", false, "report: print and sort by size allocated on disk instead of apparent size")
+	importNcdu := flag.String("f", "", "open a snapshot (ncdu dump file, \"-\" for stdin) instead of scanning a directory, the filesystem is never accessed")
+	watch := flag.Bool("watch", false, "once the scan is done, watch the scanned tree (inotify) and apply changes made by other processes")
+	useCache := flag.Bool("cache", false, "keep the last scan into a cache file, directories not modified since (same mtime) are not read again")
+	diffSnapshot := flag.String("diff", "", "compare with a previous snapshot (ncdu dump file): show size differences, new and removed entries")
+	exportNcdu := flag.String("export-ncdu", "", "write scan results as an ncdu dump to the given file (\"-\" for stdout) and exit, without the interactive interface")
+	exportJSON := flag.String("export-json", "", "write scan results as JSON to the given file (\"-\" for stdout) and exit, without the interactive interface")
+	var excludePatterns, excludeRegexps stringList
+	flag.Var(&excludePatterns, "exclude", "don't scan files/directories matching the glob pattern (can be given several times)")
+	flag.Var(&excludeRegexps, "exclude-regex", "don't scan files/directories whose full path matches the regular expression (can be given several times)")
+	excludeFile := flag.String("exclude-from", "", "read exclude rules from a file: one glob pattern per line, regular expressions prefixed by \"re:\" (the user's exclude file, UsedSpace/excludes into the configuration directory, is always read if it exists)")
+	hideExcluded := flag.Bool("hide-excluded", false, "don't display excluded files/directories (they are displayed greyed out)")
+	jobs := flag.Int("jobs", 0, "number of directories read in parallel (0 for 4 per CPU, 1 for spinning disks)")
+	rate := flag.Int("rate", 0, "maximum number of entries (files/directories) read per second (0 for no limit)")
+	nice := flag.Bool("nice", false, "lower CPU and I/O priorities (idle I/O class on Linux), so the scan doesn't slow down other processes")
+	followSymlinks := flag.Bool("L", false, "follow symbolic links pointing outside the scanned directory (each target is counted only once)")
+	flag.BoolVar(followSymlinks, "follow-symlinks", false, "same as -L")
+	maxDepth := flag.Int("max-depth", 0, "read only the given number of directory levels under the scanned directory, deeper directories are read when they are expanded (0 for all)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: UsedSpace [options] [directory | snapshot file]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-			// There is a problem yet while scanning root path. TO BE RESOLVED
-			if givenPath == "/" {
-				panic("Root path cannot be scanned yet for this version.")
-			}
+	// Exit with a readable message if the given arguments are wrong (before the terminal is taken by the app)
+	if flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "UsedSpace: too many arguments, only one directory can be scanned")
+		flag.Usage()
+		os.Exit(2)
+	}
+	headless := headlessOptions{
+		report:        *report,
+		reportOptions: usReport.ReportOptions{Top: *reportTop, Depth: *reportDepth, RawBytes: *reportBytes, UseDiskSize: *reportDiskSize},
+		exportJSON:    *exportJSON,
+		exportNcdu:    *exportNcdu,
+	}
 
-			// If the user give a path With "/" at end, remove it
-			// Root ("/" only) not considered
-			if len(givenPath) > 1 && latestChar == string(os.PathSeparator) {
-				givenPath = path.Dir(givenPath)
-			}
+	// A snapshot (results of a previous scan saved as an ncdu dump) is given with -f, or instead of the directory
+	snapshotFile := *importNcdu
+	if snapshotFile != "" && flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "UsedSpace: a directory can't be given with -f")
+		os.Exit(2)
+	}
+	if snapshotFile == "" && isSnapshotFile(flag.Args()) {
+		snapshotFile = flag.Arg(0)
+	}
 
-			// Exit if the user given a file instead of a directory path
-			if fd, _ := os.Lstat(givenPath); !fd.IsDir() {
-				panic("You have to give a directory path!!")
-			}
+	// Options used while scanning the given directory
+	scanOptions := usWalk.ScanOptions{OneFileSystem: *oneFileSystem, HideExcluded: *hideExcluded, MaxDepth: *maxDepth, Jobs: *jobs, Rate: *rate}
+	scanOptions.FollowSymlinks = *followSymlinks
+	if *nice {
+		if err := usWalk.LowerPriority(); err != nil {
+			fmt.Fprintln(os.Stderr, "UsedSpace: priority not lowered:", err) // The scan runs anyway
+		}
+	}
 
-			// Exit if the directory path doesn't exist
-			if _, err := os.Lstat(givenPath); os.IsNotExist(err) {
-				panic(err)
-			}
+	// Init variable holding informations about scanned files and directories: loaded from the snapshot, or filled by the scan
+	var dirTree *usData.DirTree
+	var givenPath string
+	var err error
+	if snapshotFile != "" {
+		if dirTree, err = usExport.ImportNcduFile(snapshotFile); err != nil {
+			exitWithError(err)
+		}
+		givenPath = dirTree.Root.Name
+	} else {
+		if givenPath, err = checkGivenPath(flag.Args()); err != nil {
+			exitWithError(err)
+		}
+		dirTree = usData.NewDirTree(givenPath)
+		if scanOptions.Excludes, err = excludeRules(excludePatterns, excludeRegexps, *excludeFile, givenPath); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	// Load the last scan of the given directory: only directories modified since will be read
+	cacheFile := ""
+	if *useCache && snapshotFile == "" {
+		if cacheFile, err = usExport.CacheFile(givenPath, scanOptions.Key()); err != nil {
+			exitWithError(err)
+		}
+		if scanOptions.Cache, err = usExport.LoadCache(cacheFile); err != nil {
+			fmt.Fprintln(os.Stderr, "UsedSpace: cache ignored:", err) // Everything is read again, and the cache replaced
 		}
 	}
 
-	// Init variable holding informations about scanned files and directories
-	cDirFilesMap := cmap.New()
+	// Load the previous snapshot to compare with
+	var baseline *usData.DirTree
+	if *diffSnapshot != "" {
+		if baseline, err = usExport.ImportNcduFile(*diffSnapshot); err != nil {
+			exitWithError(err)
+		}
+		headless.reportOptions.Baseline = baseline
+	}
+
+	// Headless mode: scan, print the report and/or export results, then exit
+	if headless.enabled() {
+		if snapshotFile == "" {
+			scanState := make(chan bool, 1) // Nobody waits for the scan: don't block at its end
+			usWalk.WalkGivenDir(context.Background(), givenPath, dirTree, scanOptions, &usWalk.ScanProgress{}, scanState)
+			if err := saveScanCache(cacheFile, dirTree); err != nil {
+				fmt.Fprintln(os.Stderr, "UsedSpace: cache not saved:", err)
+			}
+		}
+		printResults(dirTree, headless)
+		return
+	}
 
 	// Init the main app
 	usApp := tview.NewApplication()
@@ -54,45 +145,100 @@ func main() {
 	// Create page holding all pages
 	usPages := tview.NewPages()
 
+	// Init display settings shared by main page components (a snapshot is browsed without accessing the filesystem)
+	viewState := &usUI.ViewState{ReadOnly: snapshotFile != "", Baseline: baseline}
+
 	// Create header for the main layout
 	//usHeader := tview.NewTextView().SetScrollable(false).SetText(givenPath)
 	usHeader := tview.NewTable().SetSelectable(false, false)
 	usHeader.SetCell(0, 0, tview.NewTableCell(givenPath).SetTextColor(tcell.ColorGreen))
 
-	// Create footer for the main layout
-	usFooter := tview.NewTextView().SetScrollable(false).SetText("(!) Directions to navigate / TAB to switch between buttons / CTRL+C to quit").
+	// Create footer for the main layout (other keys are listed into the help page)
+	usFooter := tview.NewTextView().SetScrollable(false).SetText("(!) Directions to navigate / TAB to switch between buttons / '?' help / ESC to stop scan / CTRL+C to quit").
 		SetTextColor(tcell.ColorBlue)
 
-	// Create Waiting page (displayed until scan finished)
-	usWaitingTable := tview.NewTable().SetSelectable(false, false)
+	// Create progress view (displayed while scanning)
+	usProgressView := usUI.CreateProgressView()
 
 	// Create navigation tree, and intialize its root node
 	rootNode := tview.NewTreeNode(path.Base(givenPath)).SetColor(tcell.ColorGreen).
-		SetReference(usUI.FileDirStruct{givenPath, uint64(0), true})
+		SetReference(dirTree.Root)
 	usTree := tview.NewTreeView().SetRoot(rootNode).SetCurrentNode(rootNode)
 
 	// Create table displaying files and directories into the selected folder from the tree
 	usTable := tview.NewTable()
 	usTable.SetSelectable(true, false)
 
-	// Add the directory's path to scan to the root node
-	usUI.AddNodes(rootNode, givenPath)
-
 	// Update Header each time user navigate into the tree view
-	usUI.OnNodeChanged(usTree, usHeader)
+	usUI.OnNodeChanged(usTree, usHeader, dirTree)
 
 	// If a directory was selected, open it.
-	usUI.SetNodeSelected(usTree, usTable, usPages, cDirFilesMap, givenPath)
+	usUI.SetNodeSelected(usTree, usTable, usPages, dirTree, viewState)
 
 	// Set up the container for main page
-	usMainPage := usUI.SetUpMainPage(usTree, usTable)
+	usMainPage := usUI.SetUpMainPage(usTree, usTable, viewState)
 
-	// Display waiting page ...
-	usWaitingTable.SetCellSimple(0, 0, "Scanning "+givenPath).SetCellSimple(2, 0, "Please wait ...")
-	usPages.AddAndSwitchToPage("waitingPage", usWaitingTable, true)
+	// Create the main layout
+	usLayout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(usHeader, 2, 1, false).
+		AddItem(usPages, 0, 1, true).
+		AddItem(usProgressView, 3, 1, false).
+		AddItem(usFooter, 1, 1, false)
 
-	// Start scan in parallel then display main page immediately when scan is done
-	go waitingScan(usApp, usPages, usMainPage, usTable, usTree, usWaitingTable, givenPath, cDirFilesMap)
+	// Display main page immediately, it is filled while the scan is running
+	usUI.UpdateTableChildren(usTable, usPages, dirTree, dirTree.Root, viewState)
+	usPages.AddAndSwitchToPage("mainPage", usMainPage, true)
+
+	// Once the whole tree was read, watch it to keep sizes current (only once, even if the scan was stopped then resumed)
+	// A directory read again is watched again, even if it was stopped: its new subdirectories replace the previous ones
+	var watchOnce sync.Once
+	var watcher *usWalk.Watcher
+	scanDone := func(rescannedDir *usData.Node) {
+		saveScanCache(cacheFile, dirTree) // Not saved if it fails: the next scan reads everything again
+		if watcher != nil && rescannedDir != nil {
+			watcher.Rewatch(rescannedDir) // Events paused while it was read are applied
+			return
+		}
+		if !*watch || !dirTree.Stat(dirTree.Root).ScanDone {
+			return
+		}
+		watchOnce.Do(func() {
+			var err error
+			watcher, err = usWalk.NewWatcher(dirTree, scanOptions)
+			go watchTree(usApp, usPages, usTable, usTree, usHeader, usLayout, usProgressView, dirTree, viewState, watcher, err)
+		})
+	}
+
+	// Start scan in parallel, results are displayed while they are found (a snapshot is displayed as it is)
+	scanContext, cancelScan := context.WithCancel(context.Background())
+	if viewState.ReadOnly {
+		usUI.UpdateSnapshotView(usProgressView, snapshotFile, dirTree)
+		usLayout.ResizeItem(usProgressView, 2, 1)
+	} else {
+		viewState.ScanRunning = true
+		go liveScan(usApp, usPages, usTable, usTree, usHeader, usLayout, usProgressView, dirTree, viewState, func(scanProgress *usWalk.ScanProgress, scanState chan bool) {
+			usWalk.WalkGivenDir(scanContext, givenPath, dirTree, scanOptions, scanProgress, scanState)
+			scanDone(nil)
+		})
+	}
+
+	// Read a directory again, or a directory beyond the maximum depth when it is expanded (results are displayed while they are found)
+	rescanDir := func(dirNode *usData.Node) {
+		var rescanContext context.Context
+		rescanContext, cancelScan = context.WithCancel(context.Background())
+		viewState.ScanRunning = true
+		usLayout.ResizeItem(usProgressView, 3, 1)
+		go liveScan(usApp, usPages, usTable, usTree, usHeader, usLayout, usProgressView, dirTree, viewState, func(scanProgress *usWalk.ScanProgress, scanState chan bool) {
+			if watcher != nil {
+				watcher.Pause() // Changes made meanwhile are applied once the directory was read and watched again
+			}
+			usWalk.RescanDir(rescanContext, dirTree, dirNode, scanOptions, scanProgress, scanState)
+			scanDone(dirNode)
+		})
+	}
+	if !viewState.ReadOnly {
+		viewState.ScanDir = rescanDir
+	}
 
 	// General keys binding
 	usApp.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -107,7 +253,89 @@ func main() {
 				usApp.SetFocus(usTree)
 				return nil // Don't propagate right and left event handler to primitives into the main page
 			}
-		} else { // Don't propagate Up and Down event handler to primitives for other pages
+
+			// Switch between apparent size and size allocated on disk, then refresh the tree (weights) and the displayed directory
+			if event.Rune() == 'a' && viewState.CurrentDir != nil {
+				viewState.UseDiskSize = !viewState.UseDiskSize
+				usUI.RefreshNodes(usTree.GetRoot(), dirTree, viewState)
+				usUI.UpdateTableChildren(usTable, usPages, dirTree, viewState.CurrentDir, viewState)
+				return nil
+			}
+
+			// Switch percentages and bars between shares of the parent directory and shares of the scanned directory, then refresh the tree and the displayed directory
+			if event.Rune() == 'p' && viewState.CurrentDir != nil {
+				viewState.ShareOfRoot = !viewState.ShareOfRoot
+				usUI.RefreshNodes(usTree.GetRoot(), dirTree, viewState)
+				usUI.UpdateTableChildren(usTable, usPages, dirTree, viewState.CurrentDir, viewState)
+				return nil
+			}
+
+			// Sort the table by the next column (size, name, modification time, items, type), then refresh the displayed directory
+			if event.Rune() == 's' && viewState.CurrentDir != nil {
+				viewState.SortKey, viewState.SortAscending = usUI.NextSortKey(viewState.SortKey)
+				usUI.UpdateTableChildren(usTable, usPages, dirTree, viewState.CurrentDir, viewState)
+				return nil
+			}
+
+			// Reverse the sort order of the table, then refresh the displayed directory
+			if event.Rune() == 'o' && viewState.CurrentDir != nil {
+				viewState.SortAscending = !viewState.SortAscending
+				usUI.UpdateTableChildren(usTable, usPages, dirTree, viewState.CurrentDir, viewState)
+				return nil
+			}
+
+			// Export scan results (found so far) as JSON
+			if event.Rune() == 'j' {
+				usExportPage := usUI.CreateExportPage(dirTree, usPages, "mainPage")
+				usPages.RemovePage("exportPage")
+				usPages.AddAndSwitchToPage("exportPage", usExportPage, true)
+				return nil
+			}
+
+			// Display keyboard shortcuts
+			if event.Rune() == '?' {
+				usPages.RemovePage("helpPage")
+				usPages.AddAndSwitchToPage("helpPage", usUI.CreateHelpPage(usPages, "mainPage"), true)
+				return nil
+			}
+
+			// Display errors found while scanning
+			if event.Rune() == 'e' {
+				usErrorsPage := usUI.CreateErrorsPage(dirTree, usPages, "mainPage")
+				usPages.RemovePage("errorsPage")
+				usPages.AddAndSwitchToPage("errorsPage", usErrorsPage, true)
+				return nil
+			}
+
+			// Stop the running scan, results found so far stay displayed
+			if event.Key() == tcell.KeyEscape && viewState.ScanRunning {
+				cancelScan()
+				return nil
+			}
+
+			// Resume a stopped scan: read directories not read yet
+			if event.Rune() == 'r' && !viewState.ScanRunning && !viewState.ReadOnly && len(dirTree.UnreadDirs()) > 0 {
+				var resumeContext context.Context
+				resumeContext, cancelScan = context.WithCancel(context.Background())
+				viewState.ScanRunning = true
+				usLayout.ResizeItem(usProgressView, 3, 1)
+				go liveScan(usApp, usPages, usTable, usTree, usHeader, usLayout, usProgressView, dirTree, viewState, func(scanProgress *usWalk.ScanProgress, scanState chan bool) {
+					usWalk.ResumeScan(resumeContext, dirTree, scanOptions, scanProgress, scanState)
+					scanDone(nil)
+				})
+				return nil
+			}
+
+			// Read again the directory selected into the tree, to catch up with changes made since it was scanned
+			if event.Key() == tcell.KeyF5 && !viewState.ScanRunning && !viewState.ReadOnly && usTree.GetCurrentNode() != nil {
+				dirNode := usTree.GetCurrentNode().GetReference().(*usData.Node)
+				if dirTree.Stat(dirNode).IsMountPoint {
+					return nil // Not scanned (see --one-file-system)
+				}
+				rescanDir(dirNode)
+				return nil
+			}
+		} else if frontPage, _ := usPages.GetFrontPage(); frontPage != "errorsPage" && frontPage != "exportPage" && frontPage != "helpPage" { // Don't propagate Up and Down event handler to primitives for other pages (lists and the export format excepted)
 			if event.Key() == tcell.KeyUp {
 				return nil
 			}
@@ -119,38 +347,257 @@ func main() {
 		return event
 	})
 
-	// Create the main layout
-	usLayout := tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(usHeader, 2, 1, false).
-		AddItem(usPages, 0, 1, true).
-		AddItem(usFooter, 1, 1, false)
-
 	// Start the app
 	if err := usApp.SetRoot(usLayout, true).Run(); err != nil {
-		panic(err)
+		exitWithError(err)
+	}
+}
+
+// Outputs of the headless mode
+type headlessOptions struct {
+	report        bool // Print the size tree to stdout
+	reportOptions usReport.ReportOptions
+	exportJSON    string // File written with scan results as JSON, empty for none
+	exportNcdu    string // File written with scan results as an ncdu dump, empty for none
+}
+
+// Return true if at least one output of the headless mode was asked
+func (options headlessOptions) enabled() bool {
+	return options.report || options.exportJSON != "" || options.exportNcdu != ""
+}
+
+// Print the report and/or export results of a scan (or of a loaded dump), errors found while scanning are printed to stderr
+// Exit with a non-zero code if something couldn't be read (sizes are lower bounds)
+//	- dirTree: holds informations about scanned file/directory
+//	- options: outputs of the headless mode
+func printResults(dirTree *usData.DirTree, options headlessOptions) {
+	if options.exportJSON != "" {
+		if err := usExport.ExportJSONFile(options.exportJSON, dirTree); err != nil {
+			exitWithError(err)
+		}
+	}
+	if options.exportNcdu != "" {
+		if err := usExport.ExportNcduFile(options.exportNcdu, dirTree); err != nil {
+			exitWithError(err)
+		}
+	}
+	if options.report {
+		if err := usReport.PrintReport(os.Stdout, dirTree, options.reportOptions); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	scanErrors := dirTree.Errors()
+	for _, scanError := range scanErrors {
+		fmt.Fprintln(os.Stderr, "UsedSpace:", scanError.Kind()+":", scanError.FullPath)
+	}
+	if len(scanErrors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Return the absolute path of the directory to scan (symbolic links resolved), or an error if it can't be scanned
+// The same directory always has the same path, whatever the working directory (see usExport.CacheFile)
+//	- args: command line arguments (without options)
+func checkGivenPath(args []string) (string, error) {
+
+	// Without arguments, scan the current directory
+	givenPath := "."
+	if len(args) > 0 {
+		givenPath = args[0]
+	}
+
+	// The directory path must exist, and must not be a file
+	fd, err := os.Stat(givenPath)
+	if err != nil {
+		return "", err
+	}
+	if !fd.IsDir() {
+		return "", errors.New(givenPath + ": not a directory or ncdu snapshot")
+	}
+
+	if givenPath, err = filepath.Abs(givenPath); err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(givenPath)
+}
+
+// Return exclude rules given on the command line and into the user's exclude file, relative glob patterns are relative to the scanned directory
+//	- patterns: glob patterns
+//	- regexps: regular expressions
+//	- excludeFile: file holding exclude rules, empty if none
+//	- givenPath: path of the scanned directory
+func excludeRules(patterns []string, regexps []string, excludeFile string, givenPath string) ([]usWalk.ExcludeRule, error) {
+	excludes := []usWalk.ExcludeRule{}
+	for _, pattern := range patterns {
+		rule, err := usWalk.NewExcludeRule(pattern, false, givenPath)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, rule)
+	}
+	for _, pattern := range regexps {
+		rule, err := usWalk.NewExcludeRule(pattern, true, givenPath)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, rule)
+	}
+
+	if excludeFile != "" {
+		rules, err := usWalk.ReadExcludeFile(excludeFile, givenPath)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, rules...)
+	}
+
+	// Rules applied to every scan, without giving them each time
+	rules, err := usWalk.ReadUserExcludes(givenPath)
+	if err != nil {
+		return nil, err
+	}
+	return append(excludes, rules...), nil
+}
+
+// Save the scan into the cache file, only if the whole tree was read (a stopped scan is not saved)
+//	- cacheFile: path of the cache file, empty if the cache is not used
+//	- dirTree: holds informations about scanned file/directory
+func saveScanCache(cacheFile string, dirTree *usData.DirTree) error {
+	if cacheFile == "" || !dirTree.Stat(dirTree.Root).ScanDone {
+		return nil
 	}
+	return usExport.SaveCache(cacheFile, dirTree)
 }
 
-// Scan given folder (path) in parallel then display the main page while scan is done
+// Return true if the given argument is an ncdu dump (a snapshot to open) instead of a directory to scan
+// Other files are refused as directories to scan (see checkGivenPath)
+//	- args: command line arguments (without options)
+func isSnapshotFile(args []string) bool {
+	if len(args) != 1 {
+		return false
+	}
+	fd, err := os.Stat(args[0])
+	return err == nil && fd.Mode().IsRegular() && usExport.IsNcduFile(args[0])
+}
+
+// Print an error and exit with a non-zero code
+//	- err: error to print
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, "UsedSpace:", err)
+	os.Exit(1)
+}
+
+// Restore the terminal and exit if a goroutine of the app panics, instead of leaving the terminal broken
+//	- usApp: the main application
+func restoreTerminal(usApp *tview.Application) {
+	if recovered := recover(); recovered != nil {
+		usApp.Stop()
+		exitWithError(fmt.Errorf("%v", recovered))
+	}
+}
+
+// Scan given folder (path) in parallel and refresh the main page until scan is done
 //	- usApp: the main application
 //	- usPages: holds all pages for this application
-//	- usMainPage: this application's main page component
 //	- usTable: table list containing selected folder's content
 //	- usTree: navigation tree
-//	- usWaintingTable: Table displayed to wait until scan will be done
-//	- givenPath: directory's path to scan
-//	- cDirFilesMap: will holds informations about file/directory
-func waitingScan(usApp *tview.Application, usPages *tview.Pages, usMainPage *tview.Flex, usTable *tview.Table, usTree *tview.TreeView, usWaintingTable *tview.Table, givenPath string, cDirFilesMap cmap.ConcurrentMap) {
+//	- usHeader: header displaying the path of the directory selected into the tree
+//	- usLayout: main layout, holding the progress view
+//	- usProgressView: view displaying scan progress
+//	- dirTree: will holds informations about file/directory
+//	- viewState: display settings of the main page
+//	- startScan: start the scan (new scan, or resume a stopped one)
+func liveScan(usApp *tview.Application, usPages *tview.Pages, usTable *tview.Table, usTree *tview.TreeView, usHeader *tview.Table, usLayout *tview.Flex, usProgressView *tview.Table, dirTree *usData.DirTree, viewState *usUI.ViewState, startScan func(scanProgress *usWalk.ScanProgress, scanState chan bool)) {
+
+	defer restoreTerminal(usApp)
 
 	scanState := make(chan bool) // Channel to check if the scan is done
-	go usWalk.WalkGivenDir(givenPath, cDirFilesMap, scanState)
-	<-scanState
+	scanProgress := &usWalk.ScanProgress{}
+	go func() {
+		defer restoreTerminal(usApp)
+		startScan(scanProgress, scanState)
+	}()
 
-	// Display immediately table information about files/folders children
-	usUI.UpdateTableChildren(usTable, usPages, cDirFilesMap, givenPath, givenPath)
+	// Refresh tree, table and progress with what was found so far
+	refresh := func() {
+		usUI.RefreshNodes(usTree.GetRoot(), dirTree, viewState)
+		usUI.UpdateTableChildren(usTable, usPages, dirTree, viewState.CurrentDir, viewState)
+		usUI.FollowCurrentDir(usTree, usHeader, dirTree, viewState) // The displayed directory may have been removed
+		usUI.UpdateProgressView(usProgressView, scanProgress.Counters())
+	}
 
-	usPages.RemovePage("waitingPage")
-	usPages.AddAndSwitchToPage("mainPage", usMainPage, true)
-	usApp.Draw()           // Mandatory to refresh the current page, else we have to type some keys when scan finished
-	usApp.SetFocus(usTree) // Set the focus to the tree
+	refreshTicker := time.NewTicker(500 * time.Millisecond)
+	defer refreshTicker.Stop()
+	for {
+		select {
+		case <-refreshTicker.C:
+			usApp.QueueUpdateDraw(refresh)
+		case <-scanState:
+			usApp.QueueUpdateDraw(func() {
+				viewState.ScanRunning = false
+				refresh()
+				usLayout.ResizeItem(usProgressView, 2, 1) // Only the summary remains
+			})
+			return
+		}
+	}
+}
+
+// Watch the scanned tree and refresh the main page each time it was changed by another process
+//	- usApp: the main application
+//	- usPages: holds all pages for this application
+//	- usTable: table list containing selected folder's content
+//	- usTree: navigation tree
+//	- usHeader: header displaying the path of the directory selected into the tree
+//	- usLayout: main layout, holding the progress view
+//	- usProgressView: view displaying scan progress, and the state of the watcher
+//	- dirTree: holds informations about file/directory
+//	- viewState: display settings of the main page
+//	- watcher: watcher of the scanned tree
+//	- err: error returned while creating the watcher
+func watchTree(usApp *tview.Application, usPages *tview.Pages, usTable *tview.Table, usTree *tview.TreeView, usHeader *tview.Table, usLayout *tview.Flex, usProgressView *tview.Table, dirTree *usData.DirTree, viewState *usUI.ViewState, watcher *usWalk.Watcher, err error) {
+	defer restoreTerminal(usApp)
+
+	if err != nil {
+		usApp.QueueUpdateDraw(func() {
+			usLayout.ResizeItem(usProgressView, 3, 1)
+			usUI.UpdateWatchView(usProgressView, 0, err)
+		})
+		return
+	}
+	go func() {
+		defer restoreTerminal(usApp)
+		watcher.Run()
+	}()
+
+	// Refresh tree, table and watcher state with the changed tree
+	refresh := func() {
+		usUI.RefreshNodes(usTree.GetRoot(), dirTree, viewState)
+		usUI.UpdateTableChildren(usTable, usPages, dirTree, viewState.CurrentDir, viewState)
+		usUI.FollowCurrentDir(usTree, usHeader, dirTree, viewState) // The displayed directory may have been removed
+		usLayout.ResizeItem(usProgressView, 3, 1)
+		usUI.UpdateWatchView(usProgressView, watcher.Watched(), watcher.Err())
+	}
+
+	usApp.QueueUpdateDraw(refresh)
+	for range watcher.Changed() {
+		usApp.QueueUpdateDraw(refresh)
+		time.Sleep(500 * time.Millisecond) // Changes made meanwhile are merged into the next refresh
+	}
+}
+
+// Command line option which can be given several times
+type stringList []string
+
+// Return given values
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+// Add a given value
+//	- value: value given on the command line
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
 }
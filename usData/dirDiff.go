@@ -0,0 +1,76 @@
+// Compare two scans of the same directory: what grew, shrank, appeared or disappeared
+package usData
+
+// Structure to hold a file/directory compared with a previous scan
+type DiffEntry struct {
+	Node      *Node // Current node, nil if the file/directory was removed since the previous scan
+	Info      Node  // Copy of the current node's informations (of the previous one if it was removed)
+	OldInfo   Node  // Copy of the previous node's informations (empty if it is new)
+	IsNew     bool  // Not found into the previous scan
+	IsRemoved bool  // Found only into the previous scan
+}
+
+// Return the size difference since the previous scan (negative if it shrank)
+//	- useDiskSize: compare sizes allocated on disk instead of apparent sizes
+func (entry DiffEntry) Delta(useDiskSize bool) int64 {
+	switch {
+	case entry.IsRemoved:
+		return -int64(entry.OldInfo.DisplaySize(useDiskSize))
+	case entry.IsNew:
+		return int64(entry.Info.DisplaySize(useDiskSize))
+	}
+	return int64(entry.Info.DisplaySize(useDiskSize)) - int64(entry.OldInfo.DisplaySize(useDiskSize))
+}
+
+// Return the node of the same file/directory into another scan (same path under the scanned directory), or nil if not found
+//	- node: file/directory's node of this tree
+//	- other: tree of another scan
+func (dirTree *DirTree) Counterpart(node *Node, other *DirTree) *Node {
+	dirTree.mutex.RLock()
+	names := []string{}
+	for current := node; current.Parent != nil; current = current.Parent {
+		names = append(names, current.Name)
+	}
+	dirTree.mutex.RUnlock()
+
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+
+	current := other.Root
+	for i := len(names) - 1; i >= 0 && current != nil; i-- {
+		current = findChild(current, names[i])
+	}
+	return current
+}
+
+// Return direct children of a directory compared with a previous scan, files/directories removed since are included
+//	- dirNode: directory's node of this tree
+//	- baseline: tree of the previous scan
+func (dirTree *DirTree) DiffChildren(dirNode *Node, baseline *DirTree) []DiffEntry {
+	oldChildren := make(map[string]*Node)
+	if oldDir := dirTree.Counterpart(dirNode, baseline); oldDir != nil {
+		for _, oldChild := range baseline.Children(oldDir) {
+			oldChildren[oldChild.Name] = oldChild
+		}
+	}
+
+	entries := []DiffEntry{}
+	for _, child := range dirTree.Children(dirNode) {
+		entry := DiffEntry{Node: child, Info: dirTree.Stat(child)}
+		if oldChild, ok := oldChildren[entry.Info.Name]; ok {
+			entry.OldInfo = baseline.Stat(oldChild)
+			delete(oldChildren, entry.Info.Name)
+		} else {
+			entry.IsNew = true
+		}
+		entries = append(entries, entry)
+	}
+
+	// Remaining files/directories of the previous scan were removed since
+	for _, oldChild := range oldChildren {
+		oldInfo := baseline.Stat(oldChild)
+		entries = append(entries, DiffEntry{Info: oldInfo, OldInfo: oldInfo, IsRemoved: true})
+	}
+
+	return entries
+}
@@ -0,0 +1,77 @@
+// Check the comparison of two scans: grown, shrunk, new and removed files/directories
+package usData
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffChildren(t *testing.T) {
+	// Previous scan: a/ (f 100, g 5), old 40; current scan: a/ (f 150), new 7
+	baseline := NewDirTree("/r")
+	oldDirA := addDir(baseline, baseline.Root, "a")
+	addFile(baseline, oldDirA, "f", 100, 1, 1)
+	addFile(baseline, oldDirA, "g", 5, 2, 1)
+	addFile(baseline, baseline.Root, "old", 40, 3, 1)
+
+	dirTree := NewDirTree("/r")
+	dirA := addDir(dirTree, dirTree.Root, "a")
+	addFile(dirTree, dirA, "f", 150, 1, 1)
+	addFile(dirTree, dirTree.Root, "new", 7, 4, 1)
+
+	tests := []struct {
+		dirNode *Node
+		want    []string // Compared children: name, state and size difference
+	}{
+		{dirTree.Root, []string{"a changed 45", "new new 7", "old removed -40"}},
+		{dirA, []string{"f changed 50", "g removed -5"}},
+	}
+	for _, test := range tests {
+		got := []string{}
+		for _, entry := range dirTree.DiffChildren(test.dirNode, baseline) {
+			state := "changed"
+			switch {
+			case entry.IsNew:
+				state = "new"
+			case entry.IsRemoved:
+				state = "removed"
+				if entry.Node != nil {
+					t.Errorf("removed %s should have no current node", entry.Info.Name)
+				}
+			}
+			got = append(got, entry.Info.Name+" "+state+" "+strconv.FormatInt(entry.Delta(false), 10))
+		}
+		sort.Strings(got)
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("children of %s: %q, want %q", test.dirNode.Name, got, test.want)
+		}
+	}
+
+	// A directory only found into the current scan: all its children are new
+	dirB := addDir(dirTree, dirTree.Root, "b")
+	addFile(dirTree, dirB, "h", 9, 5, 1)
+	if entries := dirTree.DiffChildren(dirB, baseline); len(entries) != 1 || !entries[0].IsNew || entries[0].Delta(false) != 9 {
+		t.Errorf("children of b: %+v, want h new, +9", entries)
+	}
+}
+
+func TestDeltaDiskSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry DiffEntry
+		want  int64
+	}{
+		{"grown", DiffEntry{Info: Node{Size: 10, DiskSize: 8192}, OldInfo: Node{Size: 5, DiskSize: 4096}}, 4096},
+		{"shrunk", DiffEntry{Info: Node{Size: 5, DiskSize: 4096}, OldInfo: Node{Size: 10, DiskSize: 8192}}, -4096},
+		{"new", DiffEntry{Info: Node{Size: 10, DiskSize: 4096}, IsNew: true}, 4096},
+		{"removed", DiffEntry{Info: Node{Size: 10, DiskSize: 4096}, OldInfo: Node{Size: 10, DiskSize: 4096}, IsRemoved: true}, -4096},
+	}
+	for _, test := range tests {
+		if got := test.entry.Delta(true); got != test.want {
+			t.Errorf("%s: Delta(true) = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
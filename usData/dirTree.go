@@ -0,0 +1,604 @@
+// In-memory tree holding informations about scanned files and directories
+package usData
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Structure to hold file/directory informations
+type Node struct {
+	Name     string // Full path for the root node, base name for the others
+	Parent   *Node
+	Children []*Node
+
+	IsDir        bool
+	IsMountPoint bool   // Directory from another filesystem, not scanned
+	IsExcluded   bool   // Matched an exclude rule: not scanned, its size is not counted
+	LinkTarget   string // Target of a followed symbolic link, whose size is the target's one (empty for other files/directories)
+	Mode         os.FileMode
+	ModTime      time.Time
+
+	// Own sizes for files, aggregated sizes of the whole subtree for directories
+	Size     uint64 // Apparent size
+	DiskSize uint64 // Size really allocated on disk
+	Items    uint64 // Number of files/directories into the subtree (directories only)
+	Files    uint64 // Number of files into the subtree (directories only)
+	Dirs     uint64 // Number of directories into the subtree, mount points included (directories only)
+
+	// Scan state of directories: listed when its own content was read, done when the whole subtree was read
+	Listed   bool
+	ScanDone bool
+	pending  int // Number of directories (itself and its subdirectories) still being read
+
+	// Directories beyond the maximum depth are not read until they are expanded: sizes of their parents are lower bounds
+	IsDeferred  bool // Not read yet (nothing is pending: the scan goes on without it)
+	HasDeferred bool // The directory or something inside was not read yet
+
+	// Read errors: sizes of directories having errors inside are lower bounds
+	Err       error // Error while reading the file/directory itself
+	HasErrors bool  // The file/directory or something inside couldn't be read
+
+	// Hard links: the same file (device, inode) is counted into parents only once
+	Device          uint64
+	Inode           uint64
+	Links           uint64 // Number of hard links
+	IsLinkDuplicate bool   // Hard link (or target reached again through a followed symbolic link) whose bytes are already counted through another path
+}
+
+// Key identifying a file on disk, shared by all its hard links
+type inodeKey struct {
+	device uint64
+	inode  uint64
+}
+
+// Error recorded on a directory whose ignore file holds an invalid exclude rule (its other rules are not applied)
+var ErrInvalidIgnoreFile = errors.New("invalid ignore file")
+
+// Error found while scanning a file/directory
+type ScanError struct {
+	FullPath string
+	Err      error
+}
+
+// Tree of scanned files and directories
+type DirTree struct {
+	Root *Node
+
+	mutex    sync.RWMutex
+	links    map[inodeKey][]*Node // Files having several hard links, the one whose bytes are counted first: kept with the tree, not by each scan, since a removed link hands its bytes over to another one
+	followed map[inodeKey]*Node   // Files/directories reached through followed symbolic links, by the node counting them: kept with the tree, so later reads don't count them again
+	errors   []ScanError
+}
+
+// Create a tree holding only its root directory
+//	- rootPath: full path of the scanned directory
+func NewDirTree(rootPath string) *DirTree {
+	return &DirTree{
+		Root:     &Node{Name: rootPath, IsDir: true, Mode: os.ModeDir, pending: 1},
+		links:    make(map[inodeKey][]*Node),
+		followed: make(map[inodeKey]*Node),
+	}
+}
+
+// Return the full path of the file/directory
+func (node *Node) FullPath() string {
+	if node.Parent == nil {
+		return node.Name
+	}
+	return filepath.Join(node.Parent.FullPath(), node.Name)
+}
+
+// Return the apparent size, or the size allocated on disk
+//	- useDiskSize: return the size allocated on disk
+func (node *Node) DisplaySize(useDiskSize bool) uint64 {
+	if useDiskSize {
+		return node.DiskSize
+	}
+	return node.Size
+}
+
+// Return the number of files and directories the node adds into its parents: itself and its subtree (none if it is excluded)
+func (node *Node) counts() (uint64, uint64) {
+	switch {
+	case node.IsExcluded:
+		return 0, 0
+	case node.IsDir:
+		return node.Files, node.Dirs + 1
+	default:
+		return 1, 0
+	}
+}
+
+// Return true if the node is the given ancestor or one of its descendants
+//	- ancestor: node to check
+func (node *Node) isInside(ancestor *Node) bool {
+	for current := node; current != nil; current = current.Parent {
+		if current == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// Add a file/directory under its parent directory, update sizes of all its parents, and return it
+// An added directory stays pending until DirDone was called for it
+//	- parent: parent directory's node
+//	- child: file/directory's node to add
+func (dirTree *DirTree) AddChild(parent *Node, child *Node) *Node {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	child.Parent = parent
+	parent.Children = append(parent.Children, child)
+
+	// The parent is done only when the new directory will be done too
+	if child.IsDir {
+		child.pending = 1
+		parent.pending++
+	}
+
+	// Files having several hard links are counted below only if they take over the bytes of their other links (see addHardLink)
+	isHardLink := !child.IsDir && child.Links > 1
+	if isHardLink {
+		child.IsLinkDuplicate = true
+	}
+
+	// Update all directories Size (each hard linked file only once) and counts
+	files, dirs := child.counts()
+	for current := parent; current != nil; current = current.Parent {
+		current.Files += files
+		current.Dirs += dirs
+		current.Items += files + dirs
+		if !child.IsLinkDuplicate {
+			current.Size += child.Size
+			current.DiskSize += child.DiskSize
+		}
+	}
+	if isHardLink {
+		dirTree.addHardLink(child)
+	}
+
+	return child
+}
+
+// Index a file having several hard links: its bytes are counted only through the link having the smallest path,
+// whatever the order links are found in (scans and snapshots of the same tree count them at the same place)
+//	- link: node of the hard linked file, already into the tree and not counted
+func (dirTree *DirTree) addHardLink(link *Node) {
+	key := inodeKey{link.Device, link.Inode}
+	links := dirTree.links[key]
+	if len(links) > 0 && links[0].FullPath() < link.FullPath() {
+		dirTree.links[key] = append(links, link)
+		return
+	}
+
+	if len(links) > 0 {
+		setLinkCounted(links[0], false)
+	}
+	setLinkCounted(link, true)
+	dirTree.links[key] = append([]*Node{link}, links...)
+}
+
+// Record a file/directory reached through a followed symbolic link before it is added, and return false if it is already counted into the tree
+// It is counted again once the node counting it was removed (deleted, or read again)
+//	- node: node of the file/directory, its device and inode set (not checked without inode)
+func (dirTree *DirTree) CountFollowed(node *Node) bool {
+	if node.Inode == 0 {
+		return true // Can't be checked
+	}
+
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	key := inodeKey{node.Device, node.Inode}
+	if counting, ok := dirTree.followed[key]; ok && counting != node {
+		return false
+	}
+	dirTree.followed[key] = node
+	return true
+}
+
+// Count the bytes of a hard linked file into its parents, or stop counting them (another link counts them)
+//	- link: node of the hard linked file
+//	- counted: count the bytes of the file
+func setLinkCounted(link *Node, counted bool) {
+	if link.IsLinkDuplicate == !counted {
+		return
+	}
+	link.IsLinkDuplicate = !counted
+	for current := link.Parent; current != nil; current = current.Parent {
+		if counted {
+			current.Size += link.Size
+			current.DiskSize += link.DiskSize
+		} else {
+			current.Size -= link.Size
+			current.DiskSize -= link.DiskSize
+		}
+	}
+}
+
+// Return a copy of the direct children list of a directory
+//	- dirNode: directory's node
+func (dirTree *DirTree) Children(dirNode *Node) []*Node {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	return append([]*Node(nil), dirNode.Children...)
+}
+
+// Return the node of a file/directory from its full path, or nil if it was not scanned
+//	- fullPath: full path of the file/directory
+func (dirTree *DirTree) Lookup(fullPath string) *Node {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	relPath, err := filepath.Rel(dirTree.Root.Name, fullPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(os.PathSeparator)) {
+		return nil
+	}
+
+	current := dirTree.Root
+	if relPath == "." {
+		return current
+	}
+	for _, name := range strings.Split(relPath, string(os.PathSeparator)) {
+		if current = findChild(current, name); current == nil {
+			return nil
+		}
+	}
+
+	return current
+}
+
+// Return the direct child of a directory having the given name, or nil if not found
+//	- dirNode: directory's node
+//	- name: base name of the child
+func (dirTree *DirTree) Child(dirNode *Node, name string) *Node {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	return findChild(dirNode, name)
+}
+
+// Return the direct child of a directory having the given name, or nil if not found
+//	- dirNode: directory's node
+//	- name: base name of the child
+func findChild(dirNode *Node, name string) *Node {
+	for _, child := range dirNode.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Return the full path of a file/directory, safe to read while the scan is still running
+//	- node: file/directory's node
+func (dirTree *DirTree) FullPath(node *Node) string {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	return node.FullPath()
+}
+
+// Return the level of a file/directory under the scanned directory (0 for the scanned directory), safe to read while the scan is still running
+//	- node: file/directory's node
+func (dirTree *DirTree) Depth(node *Node) int {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	depth := 0
+	for current := node; current.Parent != nil; current = current.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Return a copy of the node, safe to read while the scan is still running
+//	- node: file/directory's node
+func (dirTree *DirTree) Stat(node *Node) Node {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	return *node
+}
+
+// Signal that a directory was read: it is done once all its subdirectories are done too
+//	- dirNode: directory's node
+func (dirTree *DirTree) DirDone(dirNode *Node) {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	dirNode.Listed = true
+	dirDone(dirNode)
+}
+
+// Mark a directory beyond the maximum depth: it is not read until it is expanded, it and all its parents are marked
+//	- dirNode: directory's node
+func (dirTree *DirTree) DeferDir(dirNode *Node) {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	dirNode.IsDeferred = true
+	for current := dirNode; current != nil; current = current.Parent {
+		current.HasDeferred = true
+	}
+	dirDone(dirNode)
+}
+
+// Record an error found while reading a file/directory, and mark it and all its parents
+//	- node: node of the file/directory which couldn't be read
+//	- err: error returned while reading it
+func (dirTree *DirTree) AddError(node *Node, err error) {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	node.Err = err
+	for current := node; current != nil; current = current.Parent {
+		current.HasErrors = true
+	}
+	dirTree.errors = append(dirTree.errors, ScanError{FullPath: node.FullPath(), Err: err})
+}
+
+// Return a copy of the errors list
+func (dirTree *DirTree) Errors() []ScanError {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	return append([]ScanError(nil), dirTree.errors...)
+}
+
+// Return the kind of the error: permission denied, vanished during scan or I/O error
+func (scanError ScanError) Kind() string {
+	switch {
+	case os.IsPermission(scanError.Err):
+		return "Permission denied"
+	case os.IsNotExist(scanError.Err):
+		return "Vanished during scan"
+	case errors.Is(scanError.Err, ErrInvalidIgnoreFile):
+		return "Invalid ignore file"
+	default:
+		return "I/O error"
+	}
+}
+
+// Return directories not read yet, when the scan was cancelled
+func (dirTree *DirTree) UnreadDirs() []*Node {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	return unreadDirs(dirTree.Root, []*Node{})
+}
+
+// Add directories not read yet of a subtree to the given list, and return it
+//	- dirNode: directory's node
+//	- unread: list of directories not read yet
+func unreadDirs(dirNode *Node, unread []*Node) []*Node {
+	if dirNode.ScanDone {
+		return unread
+	}
+	if !dirNode.Listed {
+		return append(unread, dirNode)
+	}
+	for _, child := range dirNode.Children {
+		if child.IsDir {
+			unread = unreadDirs(child, unread)
+		}
+	}
+	return unread
+}
+
+// Decrease pending directories count of a directory and its parents, mark them done when nothing is pending anymore
+//	- dirNode: directory's node
+func dirDone(dirNode *Node) {
+	for current := dirNode; current != nil; current = current.Parent {
+		current.pending--
+		if current.pending > 0 {
+			return
+		}
+		current.ScanDone = true
+	}
+}
+
+// Update a file modified since it was scanned, and update sizes of all its parents
+//	- node: file's node
+//	- size: new apparent size
+//	- diskSize: new size allocated on disk
+//	- modTime: new last modification time
+func (dirTree *DirTree) UpdateFile(node *Node, size uint64, diskSize uint64, modTime time.Time) {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	// Update all directories Size (a duplicate hard link was never counted into them)
+	if !node.IsLinkDuplicate {
+		for current := node.Parent; current != nil; current = current.Parent {
+			current.Size += size - node.Size
+			current.DiskSize += diskSize - node.DiskSize
+		}
+	}
+	node.Size, node.DiskSize, node.ModTime = size, diskSize, modTime
+}
+
+// Remove a deleted file/directory from the tree and update sizes of all its parents
+//	- node: node of the deleted file/directory
+func (dirTree *DirTree) Remove(node *Node) {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	dirTree.remove(node, true)
+}
+
+// Remove a file/directory moved out of its directory (it still exists elsewhere) and update sizes of all its parents
+// Its hard linked files keep their number of links
+//	- node: node of the moved file/directory
+func (dirTree *DirTree) Detach(node *Node) {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	dirTree.remove(node, false)
+}
+
+// Remove all children of a directory before it is read again: sizes of all its parents are updated, errors found inside are forgotten
+// The directory stays pending until DirDone was called for it
+//	- dirNode: directory's node
+func (dirTree *DirTree) ResetDir(dirNode *Node) {
+	dirTree.mutex.Lock()
+	defer dirTree.mutex.Unlock()
+
+	// Children are read again: they are not deleted, their hard linked files keep their number of links
+	for _, child := range append([]*Node(nil), dirNode.Children...) {
+		dirTree.remove(child, false)
+	}
+
+	// Forget errors found into the directory, parents keep the marks only if they have other errors (or directories not read yet)
+	dirPath := dirNode.FullPath()
+	keptErrors := []ScanError{}
+	for _, scanError := range dirTree.errors {
+		if scanError.FullPath != dirPath && !strings.HasPrefix(scanError.FullPath, dirPath+string(os.PathSeparator)) {
+			keptErrors = append(keptErrors, scanError)
+		}
+	}
+	dirTree.errors = keptErrors
+	dirNode.Err, dirNode.IsDeferred = nil, false
+	for current := dirNode; current != nil; current = current.Parent {
+		current.HasErrors, current.HasDeferred = current.Err != nil, current.IsDeferred
+		for _, child := range current.Children {
+			current.HasErrors = current.HasErrors || child.HasErrors
+			current.HasDeferred = current.HasDeferred || child.HasDeferred
+		}
+	}
+
+	// The directory is pending again, and so are all its parents
+	dirNode.Listed = false
+	if dirNode.pending == 0 {
+		for current := dirNode; current != nil; current = current.Parent {
+			current.pending++
+			current.ScanDone = false
+		}
+	}
+}
+
+// Return true if the file/directory is still into the tree (it or one of its parents was not removed)
+//	- node: file/directory's node
+func (dirTree *DirTree) Contains(node *Node) bool {
+	dirTree.mutex.RLock()
+	defer dirTree.mutex.RUnlock()
+
+	return node.isInside(dirTree.Root)
+}
+
+// Remove a file/directory from the tree and update sizes of all its parents (the tree must be locked)
+//	- node: node of the removed file/directory
+//	- unlinked: the file/directory was deleted, remaining hard links of its files have one link less
+func (dirTree *DirTree) remove(node *Node, unlinked bool) {
+	parent := node.Parent
+	if parent == nil {
+		return // The scanned directory itself stays into the tree
+	}
+
+	// Hard linked files still reachable from another path keep their bytes counted, followed targets are counted again if they are reached again
+	dirTree.removeHardLinks(node, node, unlinked)
+	dirTree.removeFollowed(node)
+
+	// Update all directories Size (a duplicate hard link was never counted into them)
+	sizeDelta, diskSizeDelta := node.Size, node.DiskSize
+	if node.IsLinkDuplicate {
+		sizeDelta, diskSizeDelta = uint64(0), uint64(0)
+	}
+	files, dirs := node.counts()
+	for current := parent; current != nil; current = current.Parent {
+		current.Size -= sizeDelta
+		current.DiskSize -= diskSizeDelta
+		current.Files -= files
+		current.Dirs -= dirs
+		current.Items -= files + dirs
+	}
+
+	// Detach the node from its parent
+	for i, child := range parent.Children {
+		if child == node {
+			parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+			break
+		}
+	}
+	node.Parent = nil
+
+	// A directory removed while being scanned must not keep its parents pending
+	if node.IsDir && !node.ScanDone {
+		dirDone(parent)
+	}
+}
+
+// Forget files/directories reached through followed symbolic links counted into a removed subtree
+//	- node: removed file/directory's node, or one of its descendants
+func (dirTree *DirTree) removeFollowed(node *Node) {
+	if len(dirTree.followed) == 0 {
+		return
+	}
+
+	key := inodeKey{node.Device, node.Inode}
+	if dirTree.followed[key] == node {
+		delete(dirTree.followed, key)
+	}
+	for _, child := range node.Children {
+		dirTree.removeFollowed(child)
+	}
+}
+
+// Forget hard links of removed files: if another link of a counted file is still into the tree, it takes over its bytes
+//	- node: removed file/directory's node, or one of its descendants
+//	- removed: node of the removed file/directory
+//	- unlinked: the files were deleted, their remaining links have one link less (else they were moved, or are read again)
+func (dirTree *DirTree) removeHardLinks(node *Node, removed *Node, unlinked bool) {
+	if node.IsDir {
+		for _, child := range node.Children {
+			dirTree.removeHardLinks(child, removed, unlinked)
+		}
+		return
+	}
+
+	// Only files indexed by AddChild are hard links (the number of links of the others is not checked: it may have changed)
+	key := inodeKey{node.Device, node.Inode}
+	found := false
+	remainingLinks := []*Node{}
+	for _, link := range dirTree.links[key] {
+		if link == node {
+			found = true
+		} else {
+			remainingLinks = append(remainingLinks, link)
+		}
+	}
+	if !found {
+		return
+	}
+	if len(remainingLinks) == 0 {
+		delete(dirTree.links, key)
+		return
+	}
+	dirTree.links[key] = remainingLinks
+	if unlinked {
+		for _, link := range remainingLinks {
+			link.Links--
+		}
+	}
+
+	// The remaining link having the smallest path out of the removed subtree takes over the bytes of the removed one (a duplicate was never counted)
+	if node.IsLinkDuplicate {
+		return
+	}
+	owner := -1
+	for i, link := range remainingLinks {
+		if !link.isInside(removed) && (owner < 0 || link.FullPath() < remainingLinks[owner].FullPath()) {
+			owner = i
+		}
+	}
+	if owner >= 0 {
+		setLinkCounted(remainingLinks[owner], true)
+		remainingLinks[0], remainingLinks[owner] = remainingLinks[owner], remainingLinks[0]
+	}
+}
@@ -0,0 +1,198 @@
+// Check hard link accounting of the directory tree: added, removed, moved and read again links, and targets of followed symbolic links
+package usData
+
+import (
+	"testing"
+)
+
+// Add a file under a directory of the tree, and return it
+//	- dirTree: tree of scanned files and directories
+//	- parent: parent directory's node
+//	- name: name of the file
+//	- size: apparent size (also used as size allocated on disk)
+//	- inode: inode of the file, shared by its hard links
+//	- links: number of hard links
+func addFile(dirTree *DirTree, parent *Node, name string, size uint64, inode uint64, links uint64) *Node {
+	return dirTree.AddChild(parent, &Node{Name: name, Size: size, DiskSize: size, Device: 1, Inode: inode, Links: links})
+}
+
+// Add a directory under a directory of the tree, and return it
+//	- dirTree: tree of scanned files and directories
+//	- parent: parent directory's node
+//	- name: name of the directory
+func addDir(dirTree *DirTree, parent *Node, name string) *Node {
+	return dirTree.AddChild(parent, &Node{Name: name, IsDir: true})
+}
+
+func TestAddChildCountsHardLinksOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []string // Directories the links are added into
+	}{
+		{"smallest path first", []string{"a", "d"}},
+		{"smallest path last", []string{"d", "a"}},
+	}
+	for _, test := range tests {
+		dirTree := NewDirTree("/r")
+		dirs := map[string]*Node{"a": addDir(dirTree, dirTree.Root, "a"), "d": addDir(dirTree, dirTree.Root, "d")}
+		links := map[string]*Node{}
+		for _, dirName := range test.order {
+			links[dirName] = addFile(dirTree, dirs[dirName], "f", 100, 7, 2)
+		}
+
+		if dirTree.Root.Size != 100 || dirTree.Root.DiskSize != 100 {
+			t.Errorf("%s: root size %d/%d, want 100/100", test.name, dirTree.Root.Size, dirTree.Root.DiskSize)
+		}
+		if dirs["a"].Size != 100 || dirs["d"].Size != 0 {
+			t.Errorf("%s: sizes a=%d d=%d, want the bytes counted into a (smallest path)", test.name, dirs["a"].Size, dirs["d"].Size)
+		}
+		if links["a"].IsLinkDuplicate || !links["d"].IsLinkDuplicate {
+			t.Errorf("%s: a/f duplicate %v, d/f duplicate %v", test.name, links["a"].IsLinkDuplicate, links["d"].IsLinkDuplicate)
+		}
+		if dirTree.Root.Files != 2 {
+			t.Errorf("%s: root files %d, want 2 (each link is a file)", test.name, dirTree.Root.Files)
+		}
+	}
+}
+
+func TestRemoveHardLinks(t *testing.T) {
+	tests := []struct {
+		name      string
+		remove    func(dirTree *DirTree, node *Node)
+		wantLinks uint64 // Number of links of d/f once a/f is removed
+	}{
+		{"deleted", (*DirTree).Remove, 1},
+		{"moved out", (*DirTree).Detach, 2},
+	}
+	for _, test := range tests {
+		dirTree := NewDirTree("/r")
+		dirA, dirD := addDir(dirTree, dirTree.Root, "a"), addDir(dirTree, dirTree.Root, "d")
+		linkA := addFile(dirTree, dirA, "f", 100, 7, 2)
+		linkD := addFile(dirTree, dirD, "f", 100, 7, 2)
+		addFile(dirTree, dirD, "g", 3, 8, 1)
+
+		test.remove(dirTree, linkA)
+
+		if linkD.Links != test.wantLinks {
+			t.Errorf("%s: d/f has %d links, want %d", test.name, linkD.Links, test.wantLinks)
+		}
+		if linkD.IsLinkDuplicate || dirD.Size != 103 || dirA.Size != 0 || dirTree.Root.Size != 103 {
+			t.Errorf("%s: d/f should take over the bytes, sizes a=%d d=%d root=%d", test.name, dirA.Size, dirD.Size, dirTree.Root.Size)
+		}
+		if dirTree.Contains(linkA) || !dirTree.Contains(linkD) {
+			t.Errorf("%s: a/f should be out of the tree, d/f into it", test.name)
+		}
+
+		dirTree.Remove(linkD)
+		if dirTree.Root.Size != 3 || len(dirTree.links) != 0 {
+			t.Errorf("%s: root size %d and %d indexed links once all links are removed, want 3 and 0", test.name, dirTree.Root.Size, len(dirTree.links))
+		}
+	}
+}
+
+func TestRemoveDirKeepsInnerLinksUncounted(t *testing.T) {
+	// Both links are into the removed directory: none of them takes over the bytes
+	dirTree := NewDirTree("/r")
+	dirA := addDir(dirTree, dirTree.Root, "a")
+	addFile(dirTree, dirA, "f1", 100, 7, 2)
+	addFile(dirTree, dirA, "f2", 100, 7, 2)
+	addFile(dirTree, dirTree.Root, "g", 3, 8, 1)
+
+	dirTree.Remove(dirA)
+
+	if dirTree.Root.Size != 3 || dirTree.Root.Files != 1 || dirTree.Root.Dirs != 0 {
+		t.Errorf("root size %d, %d files, %d dirs, want 3, 1, 0", dirTree.Root.Size, dirTree.Root.Files, dirTree.Root.Dirs)
+	}
+	if len(dirTree.links) != 0 {
+		t.Errorf("%d indexed links, want 0", len(dirTree.links))
+	}
+}
+
+func TestResetDirKeepsLinksOutside(t *testing.T) {
+	// a/f1 is hard linked as d/f1link, a/ is read again (F5)
+	dirTree := NewDirTree("/r")
+	dirA, dirD := addDir(dirTree, dirTree.Root, "a"), addDir(dirTree, dirTree.Root, "d")
+	addFile(dirTree, dirA, "f1", 100000, 7, 2)
+	addFile(dirTree, dirA, "g", 3, 8, 1)
+	linkD := addFile(dirTree, dirD, "f1link", 100000, 7, 2)
+
+	dirTree.ResetDir(dirA)
+	if linkD.Links != 2 {
+		t.Errorf("d/f1link has %d links after a/ was reset, want 2", linkD.Links)
+	}
+	if dirTree.Root.Size != 100000 || dirA.Size != 0 || dirA.Files != 0 {
+		t.Errorf("sizes root=%d a=%d, %d files into a, want 100000, 0, 0", dirTree.Root.Size, dirA.Size, dirA.Files)
+	}
+
+	// Read again: a/f1 counts the bytes again
+	linkA := addFile(dirTree, dirA, "f1", 100000, 7, 2)
+	addFile(dirTree, dirA, "g", 3, 8, 1)
+	dirTree.DirDone(dirA)
+	if linkA.IsLinkDuplicate || !linkD.IsLinkDuplicate || dirA.Size != 100003 || dirD.Size != 0 || dirTree.Root.Size != 100003 {
+		t.Errorf("sizes a=%d d=%d root=%d after a/ was read again, want 100003, 0, 100003", dirA.Size, dirD.Size, dirTree.Root.Size)
+	}
+
+	// Deleting the other link keeps the bytes of a/f1
+	dirTree.Remove(linkD)
+	if linkA.Links != 1 || dirTree.Root.Size != 100003 {
+		t.Errorf("a/f1 has %d links and root size %d once d/f1link is deleted, want 1 and 100003", linkA.Links, dirTree.Root.Size)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dirTree := NewDirTree("/r")
+	dirA := addDir(dirTree, dirTree.Root, "a")
+	file := addFile(dirTree, dirA, "f", 1, 7, 1)
+
+	tests := []struct {
+		fullPath string
+		want     *Node
+	}{
+		{"/r", dirTree.Root},
+		{"/r/a", dirA},
+		{"/r/a/f", file},
+		{"/r/a/missing", nil},
+		{"/other", nil},
+	}
+	for _, test := range tests {
+		if got := dirTree.Lookup(test.fullPath); got != test.want {
+			t.Errorf("Lookup(%q) = %v, want %v", test.fullPath, got, test.want)
+		}
+	}
+}
+
+func TestCountFollowed(t *testing.T) {
+	// a/l and b/l are followed symbolic links to the same directory (device 1, inode 9)
+	dirTree := NewDirTree("/r")
+	dirA, dirB := addDir(dirTree, dirTree.Root, "a"), addDir(dirTree, dirTree.Root, "b")
+	targetA := &Node{Name: "l", IsDir: true, Device: 1, Inode: 9}
+	targetB := &Node{Name: "l", IsDir: true, Device: 1, Inode: 9}
+
+	if !dirTree.CountFollowed(targetA) {
+		t.Fatalf("a/l should be counted first")
+	}
+	dirTree.AddChild(dirA, targetA)
+	if dirTree.CountFollowed(targetB) {
+		t.Errorf("b/l should not be counted again")
+	}
+	if !dirTree.CountFollowed(&Node{Name: "unknown"}) {
+		t.Errorf("a file/directory without inode can't be checked, it should be counted")
+	}
+
+	// a/ is read again: its link is counted again, the other one stays a duplicate
+	dirTree.ResetDir(dirA)
+	if !dirTree.CountFollowed(targetA) {
+		t.Errorf("a/l should be counted again once a/ was reset")
+	}
+	dirTree.AddChild(dirA, targetA)
+	if dirTree.CountFollowed(targetB) {
+		t.Errorf("b/l should not be counted once a/ was read again")
+	}
+
+	// The counting link is deleted: the target can be counted through another path
+	dirTree.Remove(targetA)
+	if !dirTree.CountFollowed(targetB) {
+		t.Errorf("b/l should be counted once a/l is removed")
+	}
+	dirTree.AddChild(dirB, targetB)
+}
@@ -0,0 +1,158 @@
+// Export scanned files and directories to a JSON document (dashboards, jq scripts, ...)
+package usExport
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	usData "UsedSpace/usData"
+)
+
+// Version of the exported JSON document, increased if its format changes
+const jsonExportVersion = 1
+
+// Structure of the exported JSON document
+type jsonDocument struct {
+	Version    int         `json:"version"`
+	Root       string      `json:"root"`       // Full path of the scanned directory
+	ExportTime time.Time   `json:"exportTime"` // Time of the export (the scan may have been stopped before)
+	Complete   bool        `json:"complete"`   // The whole tree was read (scan done, no read errors, no maximum depth reached)
+	Tree       *jsonNode   `json:"tree"`
+	Errors     []jsonError `json:"errors"`
+}
+
+// Structure of an exported file/directory
+type jsonNode struct {
+	Name      string      `json:"name"`
+	Path      string      `json:"path"`
+	Type      string      `json:"type"`     // "dir", "file", "symlink", "mountpoint" or "other"
+	Size      uint64      `json:"size"`     // Apparent size (whole subtree for directories)
+	DiskSize  uint64      `json:"diskSize"` // Size allocated on disk (whole subtree for directories)
+	ModTime   time.Time   `json:"mtime"`
+	Files     uint64      `json:"files,omitempty"`     // Number of files into the subtree (directories only)
+	Dirs      uint64      `json:"dirs,omitempty"`      // Number of directories into the subtree (directories only)
+	Links     uint64      `json:"links,omitempty"`     // Number of hard links (files having several links only)
+	Duplicate bool        `json:"duplicate,omitempty"` // Hard link whose bytes are counted through another path
+	Excluded  bool        `json:"excluded,omitempty"`  // Matched an exclude rule: not scanned, not counted
+	Deferred  bool        `json:"deferred,omitempty"`  // Beyond the maximum depth: not read, size not computed
+	Target    string      `json:"target,omitempty"`    // Target of a followed symbolic link (type and sizes are the target's ones)
+	ScanDone  bool        `json:"scanDone,omitempty"`  // The whole subtree was read (directories only)
+	Error     string      `json:"error,omitempty"`     // Error while reading the file/directory itself
+	HasErrors bool        `json:"hasErrors,omitempty"` // Something inside couldn't be read: sizes are lower bounds
+	Children  []*jsonNode `json:"children,omitempty"`
+}
+
+// Structure of an exported scan error
+type jsonError struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Write the whole scanned tree as a JSON document
+//	- writer: where the document is written
+//	- dirTree: holds informations about scanned file/directory
+func ExportJSON(writer io.Writer, dirTree *usData.DirTree) error {
+	rootInfo := dirTree.Stat(dirTree.Root)
+	document := jsonDocument{
+		Version:    jsonExportVersion,
+		Root:       rootInfo.Name,
+		ExportTime: time.Now(),
+		Complete:   rootInfo.ScanDone && !rootInfo.HasErrors && !rootInfo.HasDeferred,
+		Tree:       newJSONNode(dirTree, dirTree.Root, rootInfo.Name),
+		Errors:     []jsonError{},
+	}
+	for _, scanError := range dirTree.Errors() {
+		document.Errors = append(document.Errors, jsonError{Path: scanError.FullPath, Kind: scanError.Kind(), Message: scanError.Err.Error()})
+	}
+
+	return json.NewEncoder(writer).Encode(document)
+}
+
+// Write the whole scanned tree as a JSON document into a file ("-" for stdout)
+//	- fileName: path of the written file
+//	- dirTree: holds informations about scanned file/directory
+func ExportJSONFile(fileName string, dirTree *usData.DirTree) error {
+	return writeFile(fileName, func(writer io.Writer) error {
+		return ExportJSON(writer, dirTree)
+	})
+}
+
+// Create the exported file/directory and all its children
+//	- dirTree: holds informations about scanned file/directory
+//	- node: node of the file/directory
+//	- fullPath: full path of the file/directory
+func newJSONNode(dirTree *usData.DirTree, node *usData.Node, fullPath string) *jsonNode {
+	info := dirTree.Stat(node) // Copy: the scan may still update the node
+	exported := &jsonNode{
+		Name:      info.Name,
+		Path:      fullPath,
+		Type:      nodeType(info),
+		Size:      info.Size,
+		DiskSize:  info.DiskSize,
+		ModTime:   info.ModTime,
+		Duplicate: info.IsLinkDuplicate,
+		Excluded:  info.IsExcluded,
+		Deferred:  info.IsDeferred,
+		Target:    info.LinkTarget,
+		ScanDone:  info.ScanDone,
+		HasErrors: info.HasErrors,
+	}
+	if info.Links > 1 {
+		exported.Links = info.Links
+	}
+	if info.Err != nil {
+		exported.Error = info.Err.Error()
+	}
+	if !info.IsDir || info.IsMountPoint || info.IsExcluded {
+		return exported
+	}
+
+	// Export children, files and directories of the subtree were counted while it was scanned
+	exported.Files, exported.Dirs = info.Files, info.Dirs
+	for _, child := range dirTree.Children(node) {
+		exported.Children = append(exported.Children, newJSONNode(dirTree, child, filepath.Join(fullPath, child.Name)))
+	}
+
+	return exported
+}
+
+// Return the exported type of a file/directory
+//	- info: copy of the file/directory's node
+func nodeType(info usData.Node) string {
+	switch {
+	case info.IsMountPoint:
+		return "mountpoint"
+	case info.IsDir:
+		return "dir"
+	case info.Mode.IsRegular():
+		return "file"
+	case info.Mode&os.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return "other"
+	}
+}
+
+// Create a file and write it, or write to stdout if its name is "-"
+//	- fileName: path of the written file
+//	- write: function writing the file content
+func writeFile(fileName string, write func(writer io.Writer) error) error {
+	if fileName == "-" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
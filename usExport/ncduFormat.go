@@ -0,0 +1,462 @@
+// Read and write the ncdu JSON dump format (ncdu -o / ncdu -f):
+//	[1, 2, {metadata}, [{root directory}, {file}, [{subdirectory}, ...], ...]]
+// A directory is an array starting with its own informations, followed by its children
+package usExport
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	usData "UsedSpace/usData"
+)
+
+// Version of the ncdu dump format read and written
+const (
+	ncduMajorVersion = 1
+	ncduMinorVersion = 2
+)
+
+// Error recorded for files/directories marked unreadable into an imported dump
+var errNcduReadError = errors.New("couldn't be read (from ncdu dump)")
+
+// Unix file types (st_mode), used by the "mode" field of ncdu dumps
+const (
+	unixTypeMask    = 0170000
+	unixTypeSocket  = 0140000
+	unixTypeSymlink = 0120000
+	unixTypeRegular = 0100000
+	unixTypeBlock   = 0060000
+	unixTypeDir     = 0040000
+	unixTypeChar    = 0020000
+	unixTypeFifo    = 0010000
+)
+
+// Structure of a file/directory informations into an ncdu dump
+type ncduItem struct {
+	name       string
+	asize      uint64 // Apparent size (own size for directories, ncdu sums children itself)
+	dsize      uint64 // Size allocated on disk
+	dev        uint64
+	hasDev     bool
+	ino        uint64
+	nlink      uint64
+	hlnkc      bool   // File having several hard links
+	readError  bool   // The file/directory couldn't be read
+	notreg     bool   // Neither a regular file nor a directory
+	excluded   string // "otherfs", "kernfs", "pattern" or "frmlnk"
+	linkTarget string // Target of a followed symbolic link (written by UsedSpace only, other readers skip it)
+	mtime      int64
+	mode       uint64 // Unix st_mode (ncdu -e)
+	hasMode    bool
+}
+
+// Read an ncdu dump and return the tree it holds, without accessing the dumped filesystem
+//	- reader: ncdu dump content
+func ImportNcdu(reader io.Reader) (*usData.DirTree, error) {
+	decoder := json.NewDecoder(bufio.NewReader(reader))
+	decoder.UseNumber()
+
+	if err := expectDelim(decoder, '['); err != nil {
+		return nil, fmt.Errorf("not an ncdu dump: %w", err)
+	}
+	var majorVersion, minorVersion int
+	var metadata map[string]interface{}
+	if err := decoder.Decode(&majorVersion); err != nil {
+		return nil, err
+	}
+	if majorVersion != ncduMajorVersion {
+		return nil, fmt.Errorf("unsupported ncdu dump version %d", majorVersion)
+	}
+	if err := decoder.Decode(&minorVersion); err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, err
+	}
+
+	// Root directory: an array starting with its informations
+	if err := expectDelim(decoder, '['); err != nil {
+		return nil, err
+	}
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	rootItem, err := readNcduItem(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	dirTree := usData.NewDirTree(rootItem.name)
+	root := dirTree.Root
+	root.Mode, root.ModTime = rootItem.fileMode(true), rootItem.modTime()
+	root.Size, root.DiskSize = rootItem.asize, rootItem.dsize // Children sizes are added while they are read
+	if rootItem.readError {
+		dirTree.AddError(root, errNcduReadError)
+	}
+	if err := readNcduDir(decoder, dirTree, root, rootItem.dev, false); err != nil {
+		return nil, err
+	}
+
+	// End of the root directory, then end of the dump
+	if err := expectDelim(decoder, ']'); err != nil {
+		return nil, err
+	}
+	return dirTree, expectDelim(decoder, ']')
+}
+
+// Read an ncdu dump file ("-" for stdin) and return the tree it holds, errors found into the dump are prefixed by its name
+//	- fileName: path of the dump file
+func ImportNcduFile(fileName string) (*usData.DirTree, error) {
+	if fileName == "-" {
+		dirTree, err := ImportNcdu(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("stdin: %w", err)
+		}
+		return dirTree, nil
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dirTree, err := ImportNcdu(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return dirTree, nil
+}
+
+// Return true if the file starts like an ncdu dump: "[1," (white spaces allowed), without reading it all
+//	- fileName: path of the file
+func IsNcduFile(fileName string) bool {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 64)
+	n, _ := io.ReadFull(file, header)
+	expected := []byte("[" + strconv.Itoa(ncduMajorVersion) + ",")
+	for _, char := range header[:n] {
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			continue
+		case char != expected[0]:
+			return false
+		}
+		if expected = expected[1:]; len(expected) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Read the children of a directory until the end of its array, and add them into the tree
+//	- decoder: dump decoder, positioned after the directory informations
+//	- dirTree: tree being filled
+//	- dirNode: directory's node
+//	- dev: device of the directory, inherited by its children
+//	- followed: the directory was reached through a followed symbolic link
+func readNcduDir(decoder *json.Decoder, dirTree *usData.DirTree, dirNode *usData.Node, dev uint64, followed bool) error {
+	defer dirTree.DirDone(dirNode)
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		isDir := token == json.Delim('[')
+		if isDir {
+			if err := expectDelim(decoder, '{'); err != nil {
+				return err
+			}
+		} else if token != json.Delim('{') {
+			return fmt.Errorf("invalid ncdu dump: unexpected %v", token)
+		}
+
+		item, err := readNcduItem(decoder)
+		if err != nil {
+			return err
+		}
+		if !item.hasDev {
+			item.dev = dev
+		}
+
+		// Excluded entries were not scanned: other filesystems are kept as mount points, the others as excluded entries
+		node := &usData.Node{Name: item.name, IsDir: isDir, ModTime: item.modTime(), Links: uint64(1), LinkTarget: item.linkTarget}
+		if item.ino != 0 {
+			node.Device, node.Inode = item.dev, item.ino
+		}
+		switch item.excluded {
+		case "otherfs", "kernfs":
+			node.IsDir, node.IsMountPoint = true, true
+		case "pattern", "frmlnk":
+			node.IsExcluded = true
+			node.IsDir = item.hasMode && item.mode&unixTypeMask == unixTypeDir
+		default:
+			node.Size, node.DiskSize = item.asize, item.dsize // Own size, children sizes are added while they are read
+		}
+		node.Mode = item.fileMode(node.IsDir)
+
+		// A file with several hard links is counted only through one of its paths, the same as while scanning (see AddChild)
+		if !isDir && (item.hlnkc || item.nlink > 1) {
+			node.Device, node.Inode, node.Links = item.dev, item.ino, item.nlink
+			if node.Links < 2 {
+				node.Links = 2 // Old dumps only flag hard links, without their number
+			}
+		}
+
+		// A target reached again through a followed symbolic link is not counted again, the same as while scanning (see CountFollowed)
+		isFollowed := followed || node.LinkTarget != ""
+		if isFollowed && node.Links <= 1 && !dirTree.CountFollowed(node) {
+			node.IsLinkDuplicate = true
+		}
+
+		dirTree.AddChild(dirNode, node)
+		if item.readError {
+			dirTree.AddError(node, errNcduReadError)
+		}
+		if node.IsMountPoint || node.IsExcluded && node.IsDir {
+			dirTree.DirDone(node)
+		}
+		if isDir {
+			if err := readNcduDir(decoder, dirTree, node, item.dev, isFollowed); err != nil {
+				return err
+			}
+			if err := expectDelim(decoder, ']'); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Read the informations of a file/directory (a flat object) from the dump
+//	- decoder: dump decoder, positioned after the opening "{"
+func readNcduItem(decoder *json.Decoder) (ncduItem, error) {
+	item := ncduItem{}
+	for decoder.More() {
+		keyToken, err := decoder.Token()
+		if err != nil {
+			return item, err
+		}
+		valueToken, err := decoder.Token()
+		if err != nil {
+			return item, err
+		}
+		if _, ok := valueToken.(json.Delim); ok {
+			return item, fmt.Errorf("invalid ncdu dump: unexpected %v into %q", valueToken, keyToken)
+		}
+
+		key, _ := keyToken.(string)
+		number, _ := valueToken.(json.Number)
+		flag, _ := valueToken.(bool)
+		text, _ := valueToken.(string)
+		switch key {
+		case "name":
+			item.name = text
+		case "asize":
+			item.asize, _ = strconv.ParseUint(number.String(), 10, 64)
+		case "dsize":
+			item.dsize, _ = strconv.ParseUint(number.String(), 10, 64)
+		case "dev":
+			item.dev, _ = strconv.ParseUint(number.String(), 10, 64)
+			item.hasDev = true
+		case "ino":
+			item.ino, _ = strconv.ParseUint(number.String(), 10, 64)
+		case "nlink":
+			item.nlink, _ = strconv.ParseUint(number.String(), 10, 64)
+		case "mtime":
+			item.mtime, _ = strconv.ParseInt(number.String(), 10, 64)
+		case "mode":
+			item.mode, _ = strconv.ParseUint(number.String(), 10, 64)
+			item.hasMode = true
+		case "hlnkc":
+			item.hlnkc = flag
+		case "read_error":
+			item.readError = flag
+		case "notreg":
+			item.notreg = flag
+		case "excluded":
+			item.excluded = text
+		case "linktarget":
+			item.linkTarget = text
+		}
+	}
+
+	return item, expectDelim(decoder, '}')
+}
+
+// Read the next token and check that it is the expected delimiter
+//	- decoder: dump decoder
+//	- delim: expected delimiter
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid ncdu dump: expected %v, found %v", delim, token)
+	}
+	return nil
+}
+
+// Return the mode of a file/directory read from the dump (only its type if the dump has no mode)
+//	- isDir: the file/directory is a directory
+func (item ncduItem) fileMode(isDir bool) os.FileMode {
+	if !item.hasMode {
+		switch {
+		case isDir:
+			return os.ModeDir
+		case item.notreg:
+			return os.ModeIrregular
+		}
+		return os.FileMode(0)
+	}
+
+	mode := os.FileMode(item.mode & 0777)
+	switch item.mode & unixTypeMask {
+	case unixTypeDir:
+		mode |= os.ModeDir
+	case unixTypeSymlink:
+		mode |= os.ModeSymlink
+	case unixTypeFifo:
+		mode |= os.ModeNamedPipe
+	case unixTypeSocket:
+		mode |= os.ModeSocket
+	case unixTypeChar:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case unixTypeBlock:
+		mode |= os.ModeDevice
+	}
+	return mode
+}
+
+// Return the last modification time read from the dump (zero if the dump has no time)
+func (item ncduItem) modTime() time.Time {
+	if item.mtime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(item.mtime, 0)
+}
+
+// Write the whole scanned tree as an ncdu dump, readable with ncdu -f
+//	- writer: where the dump is written
+//	- dirTree: holds informations about scanned file/directory
+func ExportNcdu(writer io.Writer, dirTree *usData.DirTree) error {
+	bufWriter := bufio.NewWriter(writer)
+	fmt.Fprintf(bufWriter, `[%d,%d,{"progname":"UsedSpace","progver":"0.1","timestamp":%d},`, ncduMajorVersion, ncduMinorVersion, time.Now().Unix())
+	writeNcduNode(bufWriter, dirTree, dirTree.Root)
+	fmt.Fprintln(bufWriter, "]")
+
+	return bufWriter.Flush()
+}
+
+// Write the whole scanned tree as an ncdu dump into a file ("-" for stdout)
+//	- fileName: path of the written file
+//	- dirTree: holds informations about scanned file/directory
+func ExportNcduFile(fileName string, dirTree *usData.DirTree) error {
+	return writeFile(fileName, func(writer io.Writer) error {
+		return ExportNcdu(writer, dirTree)
+	})
+}
+
+// Write a file, or a directory and all its children
+// Directories sizes are the sum of their children into ncdu dumps: only the space allocated to the directory itself is written
+//	- writer: where the dump is written
+//	- dirTree: holds informations about scanned file/directory
+//	- node: node of the file/directory
+func writeNcduNode(writer *bufio.Writer, dirTree *usData.DirTree, node *usData.Node) {
+	info := dirTree.Stat(node) // Copy: the scan may still update the node
+	name, _ := json.Marshal(info.Name)
+
+	isDir := info.IsDir && !info.IsMountPoint && !info.IsExcluded && !info.IsDeferred
+	if isDir {
+		writer.WriteString("[")
+	}
+	fmt.Fprintf(writer, `{"name":%s`, name)
+	if info.IsMountPoint {
+		writer.WriteString(`,"excluded":"otherfs"`)
+	} else if info.IsExcluded || info.IsDeferred {
+		writer.WriteString(`,"excluded":"pattern"`) // Not scanned (ncdu has no directories left to read later)
+	} else if !info.IsDir {
+		fmt.Fprintf(writer, `,"asize":%d,"dsize":%d`, info.Size, info.DiskSize)
+	} else if ownDiskSize := dirOwnDiskSize(dirTree, node, info); ownDiskSize > 0 {
+		fmt.Fprintf(writer, `,"dsize":%d`, ownDiskSize)
+	}
+	if info.Inode != 0 {
+		fmt.Fprintf(writer, `,"dev":%d,"ino":%d`, info.Device, info.Inode) // Hard links and followed targets are counted once when read again
+	}
+	if info.Links > 1 {
+		fmt.Fprintf(writer, `,"hlnkc":true,"nlink":%d`, info.Links)
+	}
+	if info.LinkTarget != "" {
+		linkTarget, _ := json.Marshal(info.LinkTarget)
+		fmt.Fprintf(writer, `,"linktarget":%s`, linkTarget)
+	}
+	if info.Err != nil {
+		writer.WriteString(`,"read_error":true`)
+	}
+	if !info.IsDir && !info.Mode.IsRegular() {
+		writer.WriteString(`,"notreg":true`)
+	}
+	fmt.Fprintf(writer, `,"mode":%d,"mtime":%d}`, unixMode(info.Mode), info.ModTime.Unix())
+
+	if isDir {
+		for _, child := range dirTree.Children(node) {
+			writer.WriteString(",")
+			writeNcduNode(writer, dirTree, child)
+		}
+		writer.WriteString("]")
+	}
+}
+
+// Return the space allocated on disk for a directory itself: its disk size without the sizes of its children
+//	- dirTree: holds informations about scanned file/directory
+//	- dirNode: directory's node
+//	- info: copy of the directory's node
+func dirOwnDiskSize(dirTree *usData.DirTree, dirNode *usData.Node, info usData.Node) uint64 {
+	childrenSize := uint64(0)
+	for _, child := range dirTree.Children(dirNode) {
+		if childInfo := dirTree.Stat(child); !childInfo.IsLinkDuplicate {
+			childrenSize += childInfo.DiskSize
+		}
+	}
+	if childrenSize > info.DiskSize {
+		return 0 // Children found by the running scan since the copy
+	}
+	return info.DiskSize - childrenSize
+}
+
+// Return the Unix st_mode of a file/directory mode
+//	- mode: mode of the file/directory
+func unixMode(mode os.FileMode) uint64 {
+	unix := uint64(mode.Perm())
+	switch {
+	case mode&os.ModeDir != 0:
+		unix |= unixTypeDir
+	case mode&os.ModeSymlink != 0:
+		unix |= unixTypeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		unix |= unixTypeFifo
+	case mode&os.ModeSocket != 0:
+		unix |= unixTypeSocket
+	case mode&os.ModeCharDevice != 0:
+		unix |= unixTypeChar
+	case mode&os.ModeDevice != 0:
+		unix |= unixTypeBlock
+	default:
+		unix |= unixTypeRegular
+	}
+	return unix
+}
@@ -0,0 +1,187 @@
+// Check reading and writing ncdu dumps: sizes, hard links, round trip and invalid dumps
+package usExport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	usData "UsedSpace/usData"
+)
+
+// Dump of /r holding d/f1link before a/f1 (hard links of the same file), a/g and an excluded directory
+const testNcduDump = `[1,2,{"progname":"ncdu","progver":"1.19","timestamp":1700000000},
+[{"name":"/r","dsize":4096,"dev":1,"mode":16877,"mtime":1700000000},
+ [{"name":"d","dsize":4096,"mode":16877,"mtime":1700000000},
+  {"name":"f1link","asize":100000,"dsize":102400,"ino":7,"hlnkc":true,"nlink":2,"mode":33188,"mtime":1700000000}],
+ [{"name":"a","dsize":4096,"mode":16877,"mtime":1700000000},
+  {"name":"f1","asize":100000,"dsize":102400,"ino":7,"hlnkc":true,"nlink":2,"mode":33188,"mtime":1700000000},
+  {"name":"g","asize":3,"dsize":4096,"mode":33188,"mtime":1700000000}],
+ {"name":"skipped","excluded":"pattern","mode":16877,"mtime":1700000000}]]
+`
+
+// Sizes expected into the test dump: apparent size, size allocated on disk
+var testNcduSizes = []struct {
+	fullPath string
+	size     uint64
+	diskSize uint64
+}{
+	{"/r", 100003, 4096 + 4096 + 4096 + 102400 + 4096},
+	{"/r/a", 100003, 4096 + 102400 + 4096},
+	{"/r/a/f1", 100000, 102400},
+	{"/r/d", 0, 4096}, // Its link is counted into a/ (smallest path), whatever the order of the dump
+	{"/r/skipped", 0, 0},
+}
+
+// Check sizes of the test dump read into a tree
+//	- t: test state
+//	- dirTree: tree read from the test dump
+//	- step: checked step, to report errors
+func checkNcduSizes(t *testing.T, dirTree *usData.DirTree, step string) {
+	for _, expected := range testNcduSizes {
+		node := dirTree.Lookup(expected.fullPath)
+		if node == nil {
+			t.Errorf("%s: %s not found", step, expected.fullPath)
+			continue
+		}
+		if node.Size != expected.size || node.DiskSize != expected.diskSize {
+			t.Errorf("%s: %s size %d/%d, want %d/%d", step, expected.fullPath, node.Size, node.DiskSize, expected.size, expected.diskSize)
+		}
+	}
+}
+
+func TestImportNcdu(t *testing.T) {
+	dirTree, err := ImportNcdu(strings.NewReader(testNcduDump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNcduSizes(t, dirTree, "import")
+
+	if link := dirTree.Lookup("/r/d/f1link"); link == nil || !link.IsLinkDuplicate || link.Links != 2 {
+		t.Errorf("d/f1link should be a duplicate having 2 links: %+v", link)
+	}
+	if skipped := dirTree.Lookup("/r/skipped"); skipped == nil || !skipped.IsExcluded || !skipped.IsDir {
+		t.Errorf("skipped should be an excluded directory: %+v", skipped)
+	}
+	if !dirTree.Root.ScanDone {
+		t.Errorf("the imported tree should be done")
+	}
+}
+
+func TestNcduRoundTrip(t *testing.T) {
+	dirTree, err := ImportNcdu(strings.NewReader(testNcduDump))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Export and import again twice: sizes and hard link owners don't move
+	for _, step := range []string{"first round trip", "second round trip"} {
+		var dump bytes.Buffer
+		if err := ExportNcdu(&dump, dirTree); err != nil {
+			t.Fatal(err)
+		}
+		if dirTree, err = ImportNcdu(&dump); err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		checkNcduSizes(t, dirTree, step)
+	}
+}
+
+func TestImportNcduErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		dump    string
+		wantErr string
+	}{
+		{"not JSON", "\x1c\x00binary", "not an ncdu dump"},
+		{"JSON object", `{"name":"/r"}`, "not an ncdu dump"},
+		{"other version", `[2,0,{},[{"name":"/r"}]]`, "unsupported ncdu dump version 2"},
+		{"truncated", testNcduDump[:len(testNcduDump)/2], "unexpected end of JSON input"},
+		{"object into an item", `[1,2,{},[{"name":"/r"},{"name":"f","asize":{}}]]`, "invalid ncdu dump"},
+	}
+	for _, test := range tests {
+		_, err := ImportNcdu(strings.NewReader(test.dump))
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestNcduFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	tests := []struct {
+		name      string
+		content   string
+		isNcdu    bool
+		importErr bool
+	}{
+		{"dump.ncdu", testNcduDump, true, false},
+		{"spaces.ncdu", " \n[ 1 ,\n2,{},[{\"name\":\"/r\"}]]", true, false},
+		{"truncated.ncdu", testNcduDump[:40], true, true},
+		{"binary.bin", "\x1c\x00\x00binary", false, true},
+		{"object.json", `{"name":"/r"}`, false, true},
+		{"empty", "", false, true},
+	}
+	for _, test := range tests {
+		fileName := filepath.Join(tempDir, test.name)
+		if err := os.WriteFile(fileName, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if isNcdu := IsNcduFile(fileName); isNcdu != test.isNcdu {
+			t.Errorf("IsNcduFile(%s) = %v, want %v", test.name, isNcdu, test.isNcdu)
+		}
+		_, err := ImportNcduFile(fileName)
+		if (err != nil) != test.importErr {
+			t.Errorf("ImportNcduFile(%s) error %v, want error %v", test.name, err, test.importErr)
+		}
+		if err != nil && !strings.HasPrefix(err.Error(), fileName+": ") {
+			t.Errorf("ImportNcduFile(%s) error %q should start with the file name", test.name, err)
+		}
+	}
+
+	if IsNcduFile(filepath.Join(tempDir, "missing")) {
+		t.Errorf("a missing file is not an ncdu dump")
+	}
+}
+
+func TestNcduRoundTripFollowedLinks(t *testing.T) {
+	// a/l1 and a/l2 are followed symbolic links to the same file (device 1, inode 9), counted only through a/l1
+	dirTree := usData.NewDirTree("/r")
+	dirA := dirTree.AddChild(dirTree.Root, &usData.Node{Name: "a", IsDir: true})
+	for _, name := range []string{"l1", "l2"} {
+		link := &usData.Node{Name: name, Size: 1000000, DiskSize: 1003520, Device: 1, Inode: 9, Links: 1, LinkTarget: "/outside/big"}
+		link.IsLinkDuplicate = !dirTree.CountFollowed(link)
+		dirTree.AddChild(dirA, link)
+	}
+	dirTree.DirDone(dirA)
+	dirTree.DirDone(dirTree.Root)
+
+	// Export and import again twice: the target stays counted once, links keep their target
+	for _, step := range []string{"first round trip", "second round trip"} {
+		var dump bytes.Buffer
+		if err := ExportNcdu(&dump, dirTree); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if dirTree, err = ImportNcdu(&dump); err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+
+		if dirTree.Root.Size != 1000000 || dirTree.Root.DiskSize != 1003520 {
+			t.Errorf("%s: root size %d/%d, want 1000000/1003520", step, dirTree.Root.Size, dirTree.Root.DiskSize)
+		}
+		link1, link2 := dirTree.Lookup("/r/a/l1"), dirTree.Lookup("/r/a/l2")
+		if link1 == nil || link2 == nil {
+			t.Fatalf("%s: links not found", step)
+		}
+		if link1.IsLinkDuplicate || !link2.IsLinkDuplicate {
+			t.Errorf("%s: l1 duplicate %v, l2 duplicate %v, want only l2", step, link1.IsLinkDuplicate, link2.IsLinkDuplicate)
+		}
+		if link1.LinkTarget != "/outside/big" || link2.LinkTarget != "/outside/big" {
+			t.Errorf("%s: link targets %q and %q, want /outside/big", step, link1.LinkTarget, link2.LinkTarget)
+		}
+	}
+}
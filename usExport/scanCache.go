@@ -0,0 +1,50 @@
+// Keep the last scan of each directory into a cache file (an ncdu dump), reused by the next scan of the same directory
+package usExport
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	usData "UsedSpace/usData"
+)
+
+// Return the path of the cache file of a scanned directory, into the user's cache directory
+//	- rootPath: full path of the scanned directory
+//	- optionsKey: scan options changing results (each set of options has its own cache file)
+func CacheFile(rootPath string, optionsKey string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum([]byte(rootPath + "\x00" + optionsKey))
+	return filepath.Join(cacheDir, "UsedSpace", hex.EncodeToString(sum[:])+".ncdu.json"), nil
+}
+
+// Load the last scan from a cache file, or return nil if there is no cache yet
+//	- cacheFile: path of the cache file
+func LoadCache(cacheFile string) (*usData.DirTree, error) {
+	dirTree, err := ImportNcduFile(cacheFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return dirTree, err
+}
+
+// Save a scan into a cache file, replaced at once (a reader never sees a partly written cache)
+//	- cacheFile: path of the cache file
+//	- dirTree: holds informations about scanned file/directory
+func SaveCache(cacheFile string, dirTree *usData.DirTree) error {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0700); err != nil {
+		return err
+	}
+
+	tmpFile := cacheFile + ".tmp"
+	if err := ExportNcduFile(tmpFile, dirTree); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, cacheFile)
+}
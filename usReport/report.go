@@ -0,0 +1,211 @@
+// Print scan results as a text report, without the interactive interface (for scripts, cron jobs, CI)
+package usReport
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+
+	usData "UsedSpace/usData"
+)
+
+// Options of the printed report
+type ReportOptions struct {
+	Top         int  // Number of largest entries printed per directory (0 to print all of them)
+	Depth       int  // Number of directory levels printed under the scanned directory
+	RawBytes    bool // Print sizes in bytes instead of human readable units
+	UseDiskSize bool // Print and sort by size allocated on disk instead of apparent size
+
+	Baseline *usData.DirTree // Previous scan to compare with: print size differences, sort by absolute growth (nil if not comparing)
+}
+
+// Structure to hold a printed file/directory
+type reportEntry struct {
+	node *usData.Node // Reference used to print its children (nil if removed since the previous scan)
+	info usData.Node  // Copy of node's informations
+
+	// Comparison with the previous scan (see ReportOptions.Baseline)
+	delta     int64 // Size difference since the previous scan
+	isNew     bool
+	isRemoved bool
+}
+
+// Print the size tree of the scanned directory: largest entries first, up to the given depth
+//	- writer: where the report is printed (usually stdout)
+//	- dirTree: holds informations about scanned file/directory
+//	- reportOptions: options of the printed report
+func PrintReport(writer io.Writer, dirTree *usData.DirTree, reportOptions ReportOptions) error {
+	root := reportEntry{node: dirTree.Root, info: dirTree.Stat(dirTree.Root)}
+	if reportOptions.Baseline != nil {
+		oldRootInfo := reportOptions.Baseline.Stat(reportOptions.Baseline.Root)
+		root.delta = int64(root.info.DisplaySize(reportOptions.UseDiskSize)) - int64(oldRootInfo.DisplaySize(reportOptions.UseDiskSize))
+	}
+	if _, err := fmt.Fprintln(writer, reportLine(root, root.info.Name, 0, reportOptions)); err != nil {
+		return err
+	}
+
+	return printChildren(writer, dirTree, dirTree.Root, 1, reportOptions)
+}
+
+// Print the largest direct children of a directory, and their own children until the given depth
+//	- writer: where the report is printed
+//	- dirTree: holds informations about scanned file/directory
+//	- dirNode: directory to print children
+//	- level: depth of the children under the scanned directory
+//	- reportOptions: options of the printed report
+func printChildren(writer io.Writer, dirTree *usData.DirTree, dirNode *usData.Node, level int, reportOptions ReportOptions) error {
+	if level > reportOptions.Depth {
+		return nil
+	}
+
+	children := []reportEntry{}
+	if reportOptions.Baseline == nil {
+		for _, child := range dirTree.Children(dirNode) {
+			children = append(children, reportEntry{node: child, info: dirTree.Stat(child)})
+		}
+
+		// Sort result by size, entries of the same size by name (the report is the same from one run to another)
+		sort.SliceStable(children, func(i, j int) bool {
+			first, second := children[i].info.DisplaySize(reportOptions.UseDiskSize), children[j].info.DisplaySize(reportOptions.UseDiskSize)
+			if first == second {
+				return children[i].info.Name < children[j].info.Name
+			}
+			return first > second
+		})
+	} else {
+		for _, entry := range dirTree.DiffChildren(dirNode, reportOptions.Baseline) {
+			children = append(children, reportEntry{
+				node:      entry.Node,
+				info:      entry.Info,
+				delta:     entry.Delta(reportOptions.UseDiskSize),
+				isNew:     entry.IsNew,
+				isRemoved: entry.IsRemoved,
+			})
+		}
+
+		// Sort result by absolute growth, entries of the same growth by name
+		sort.SliceStable(children, func(i, j int) bool {
+			first, second := absDelta(children[i].delta), absDelta(children[j].delta)
+			if first == second {
+				return children[i].info.Name < children[j].info.Name
+			}
+			return first > second
+		})
+	}
+
+	// Keep only the largest entries, the others are summed up into a single line
+	hidden := []reportEntry{}
+	if reportOptions.Top > 0 && len(children) > reportOptions.Top {
+		hidden = children[reportOptions.Top:]
+		children = children[:reportOptions.Top]
+	}
+
+	for _, child := range children {
+		if _, err := fmt.Fprintln(writer, reportLine(child, child.info.Name, level, reportOptions)); err != nil {
+			return err
+		}
+		if child.info.IsDir && !child.isRemoved {
+			if err := printChildren(writer, dirTree, child.node, level+1, reportOptions); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(hidden) > 0 {
+		hiddenEntry := reportEntry{}
+		for _, child := range hidden {
+			if child.info.IsLinkDuplicate {
+				continue // Duplicate hard links and followed targets are not counted into their parent
+			}
+			if !child.isRemoved {
+				hiddenEntry.info.Size += child.info.Size
+				hiddenEntry.info.DiskSize += child.info.DiskSize
+				hiddenEntry.info.HasErrors = hiddenEntry.info.HasErrors || child.info.HasErrors
+				hiddenEntry.info.HasDeferred = hiddenEntry.info.HasDeferred || child.info.HasDeferred
+			}
+			hiddenEntry.delta += child.delta
+		}
+		hiddenText := "(" + strconv.Itoa(len(hidden)) + " more entries)"
+		if _, err := fmt.Fprintln(writer, reportLine(hiddenEntry, hiddenText, level, reportOptions)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return the report line of a file/directory: its size (and its size difference if comparing), then its name indented by its depth
+//	- entry: printed file/directory
+//	- name: name printed for the file/directory
+//	- level: depth of the file/directory under the scanned directory
+//	- reportOptions: options of the printed report
+func reportLine(entry reportEntry, name string, level int, reportOptions ReportOptions) string {
+	info := entry.info
+	size := info.DisplaySize(reportOptions.UseDiskSize)
+	if entry.isRemoved {
+		size = 0
+	}
+	printedSize := formatSize(size, reportOptions.RawBytes)
+
+	// Something inside couldn't be read, or was not read (beyond the maximum depth of the scan): size is a lower bound
+	if (info.HasErrors || info.HasDeferred) && !entry.isRemoved {
+		printedSize = ">= " + printedSize
+	}
+
+	// Directories end with "/", mount points and excluded entries were not scanned
+	if info.IsDir && level > 0 {
+		name += "/"
+	}
+	if info.LinkTarget != "" {
+		name += " -> " + info.LinkTarget
+	}
+	if info.IsMountPoint {
+		name += " (mount point)"
+	}
+	if info.IsExcluded {
+		name += " (excluded)"
+	}
+	if info.IsDeferred {
+		name += " (not computed)"
+	}
+
+	if reportOptions.Baseline == nil {
+		return fmt.Sprintf("%15s  %s%s", printedSize, strings.Repeat("  ", level), name)
+	}
+
+	// Comparing with a previous scan: add the signed size difference
+	deltaText := "+" + formatSize(uint64(entry.delta), reportOptions.RawBytes)
+	if entry.delta < 0 {
+		deltaText = "-" + formatSize(uint64(-entry.delta), reportOptions.RawBytes)
+	}
+	if entry.isNew {
+		name += " (new)"
+	}
+	if entry.isRemoved {
+		name += " (removed)"
+	}
+	return fmt.Sprintf("%15s %15s  %s%s", printedSize, deltaText, strings.Repeat("  ", level), name)
+}
+
+// Return the printed size
+//	- size: size in bytes
+//	- rawBytes: print size in bytes instead of human readable units
+func formatSize(size uint64, rawBytes bool) string {
+	if rawBytes {
+		return strconv.FormatUint(size, 10)
+	}
+	return humanize.Bytes(size)
+}
+
+// Return the absolute value of a size difference
+//	- delta: size difference
+func absDelta(delta int64) int64 {
+	if delta < 0 {
+		return -delta
+	}
+	return delta
+}
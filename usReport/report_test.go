@@ -0,0 +1,103 @@
+// Check printed reports: largest entries first, summed up entries, depth, and comparison with a previous scan
+package usReport
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+
+	usData "UsedSpace/usData"
+)
+
+// Structure to hold a file of a test tree
+type testFile struct {
+	path  string // Path under the scanned directory, at most one directory level (created as needed)
+	size  uint64
+	inode uint64 // Hard links of the same file share their inode (0 for a file having a single link)
+}
+
+// Return a scanned tree holding the given files, all its directories done
+//	- files: files of the tree
+func testTree(files ...testFile) *usData.DirTree {
+	dirTree := usData.NewDirTree("/r")
+	dirs := map[string]*usData.Node{".": dirTree.Root}
+	for _, file := range files {
+		dirName, name := path.Split(file.path)
+		dirName = path.Clean(dirName)
+		if dirs[dirName] == nil {
+			dirs[dirName] = dirTree.AddChild(dirTree.Root, &usData.Node{Name: dirName, IsDir: true})
+		}
+		node := &usData.Node{Name: name, Size: file.size, DiskSize: file.size, Links: 1}
+		if file.inode != 0 {
+			node.Device, node.Inode, node.Links = 1, file.inode, 2
+		}
+		dirTree.AddChild(dirs[dirName], node)
+	}
+	for _, dirNode := range dirs {
+		dirTree.DirDone(dirNode)
+	}
+	return dirTree
+}
+
+func TestPrintReport(t *testing.T) {
+	// z is a hard link of a/f1, counted into a/ (smallest path): it is summed up without its bytes
+	dirTree := testTree(testFile{"a/f1", 100, 7}, testFile{"big", 500, 0}, testFile{"x", 10, 0}, testFile{"y", 10, 0}, testFile{"z", 100, 7})
+
+	tests := []struct {
+		name          string
+		reportOptions ReportOptions
+		want          []string
+	}{
+		{"largest entries", ReportOptions{Top: 2, Depth: 1, RawBytes: true}, []string{
+			"            620  /r",
+			"            500    big",
+			"            100    a/",
+			"             20    (3 more entries)",
+		}},
+		{"all entries, two levels", ReportOptions{Depth: 2, RawBytes: true}, []string{
+			"            620  /r",
+			"            500    big",
+			"            100    a/",
+			"            100      f1",
+			"            100    z",
+			"             10    x",
+			"             10    y",
+		}},
+		{"human readable", ReportOptions{Top: 1, Depth: 1}, []string{
+			"          620 B  /r",
+			"          500 B    big",
+			"          120 B    (4 more entries)",
+		}},
+	}
+	for _, test := range tests {
+		var report bytes.Buffer
+		if err := PrintReport(&report, dirTree, test.reportOptions); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSuffix(report.String(), "\n"); got != strings.Join(test.want, "\n") {
+			t.Errorf("%s:\n%s\nwant:\n%s", test.name, got, strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestPrintReportBaseline(t *testing.T) {
+	baseline := testTree(testFile{"a/f1", 100, 0}, testFile{"big", 400, 0}, testFile{"old", 30, 0})
+	dirTree := testTree(testFile{"a/f1", 100, 0}, testFile{"big", 500, 0}, testFile{"x", 10, 0})
+
+	// Sorted by absolute growth: removed and new entries included
+	want := []string{
+		"            610             +80  /r",
+		"            500            +100    big",
+		"              0             -30    old (removed)",
+		"             10             +10    x (new)",
+		"            100              +0    a/",
+	}
+	var report bytes.Buffer
+	if err := PrintReport(&report, dirTree, ReportOptions{Depth: 1, RawBytes: true, Baseline: baseline}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSuffix(report.String(), "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("report:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,49 @@
+// Create the page listing errors found while scanning:
+//	- kind of error (permission denied, vanished during scan, I/O error)
+//	- full path of the file/directory which couldn't be read
+//	- error message
+package usUI
+
+import (
+	"strconv"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+
+	usData "UsedSpace/usData"
+)
+
+// Create the errors page
+//	- dirTree: holds informations about scanned file/directory, and errors found
+//	- pages: holds all pages for this application
+//	- nextPage: reference of the next page
+func CreateErrorsPage(dirTree *usData.DirTree, pages *tview.Pages, nextPage string) *tview.Flex {
+	scanErrors := dirTree.Errors()
+
+	errorsTitle := tview.NewTextView().SetScrollable(false).SetTextColor(tcell.ColorBlue).
+		SetText("Scan errors (" + strconv.Itoa(len(scanErrors)) + "), sizes of directories marked \"(read errors)\" are lower bounds")
+
+	errorsTable := tview.NewTable().SetSelectable(true, false)
+	if len(scanErrors) == 0 {
+		errorsTable.SetCell(0, 0, tview.NewTableCell("No error found.").SetTextColor(tcell.ColorGreen))
+	}
+	for i, scanError := range scanErrors {
+		errorsTable.SetCell(i, 0, tview.NewTableCell(scanError.Kind()).SetTextColor(tcell.ColorRed)).
+			SetCell(i, 1, tview.NewTableCell(" "+scanError.FullPath).SetTextColor(tcell.ColorGreen)).
+			SetCell(i, 2, tview.NewTableCell(" "+scanError.Err.Error()))
+	}
+
+	// Leave the page with the OK button, or by selecting an error
+	errorsTable.SetSelectedFunc(func(row int, column int) {
+		pages.SwitchToPage(nextPage)
+	})
+	form := tview.NewForm().AddButton("OK", func() {
+		pages.SwitchToPage(nextPage)
+	})
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(errorsTitle, 2, 1, false).
+		AddItem(errorsTable, 0, 1, true).
+		AddItem(form, 3, 1, false)
+	return flex
+}
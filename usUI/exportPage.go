@@ -0,0 +1,85 @@
+// Create the page exporting scan results to a file:
+//	- format of the file (JSON, ncdu dump)
+//	- name of the written file
+//	- confirmation once the file was written
+package usUI
+
+import (
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+
+	usData "UsedSpace/usData"
+	usExport "UsedSpace/usExport"
+)
+
+// Structure to hold an export format
+type exportFormat struct {
+	name        string
+	defaultFile string // Default name of the exported file, written into the current directory
+	export      func(fileName string, dirTree *usData.DirTree) error
+}
+
+// Available export formats
+var exportFormats = []exportFormat{
+	{name: "JSON", defaultFile: "UsedSpace.json", export: usExport.ExportJSONFile},
+	{name: "ncdu dump", defaultFile: "UsedSpace.ncdu.json", export: usExport.ExportNcduFile},
+}
+
+// Create the export page
+//	- dirTree: holds informations about scanned file/directory
+//	- pages: holds all pages for this application
+//	- nextPage: reference of the next page
+func CreateExportPage(dirTree *usData.DirTree, pages *tview.Pages, nextPage string) *tview.Flex {
+	exportTitle := tview.NewTextView().SetScrollable(false).SetTextColor(tcell.ColorBlue).
+		SetText("Export scan results (directories still being scanned are exported as they are)")
+
+	// Changing the format changes the default file name
+	fileField := tview.NewInputField().SetLabel("File").SetText(exportFormats[0].defaultFile).SetFieldWidth(60)
+	formatNames := []string{}
+	for _, format := range exportFormats {
+		formatNames = append(formatNames, format.name)
+	}
+	selectedFormat := exportFormats[0]
+	formatField := tview.NewDropDown().SetLabel("Format").SetOptions(formatNames, func(text string, index int) {
+		if fileField.GetText() == selectedFormat.defaultFile {
+			fileField.SetText(exportFormats[index].defaultFile)
+		}
+		selectedFormat = exportFormats[index]
+	}).SetCurrentOption(0)
+
+	form := tview.NewForm().AddFormItem(formatField).AddFormItem(fileField)
+	form.AddButton("Export", func() {
+		fileName := fileField.GetText()
+		if err := selectedFormat.export(fileName, dirTree); err != nil {
+			ShowErrorPage(fileName, "can't be written", err, pages, nextPage)
+			return
+		}
+
+		// No way to refresh, so delete and create
+		pages.RemovePage("exportDonePage")
+		pages.AddAndSwitchToPage("exportDonePage", createExportDonePage(fileName, pages, nextPage), true)
+	}).
+		AddButton("Cancel", func() {
+			pages.SwitchToPage(nextPage)
+		})
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).AddItem(exportTitle, 2, 1, false).AddItem(form, 0, 1, true)
+	return flex
+}
+
+// Create the page confirming that scan results were exported
+//	- fileName: path of the written file
+//	- pages: holds all pages for this application
+//	- nextPage: reference of the next page
+func createExportDonePage(fileName string, pages *tview.Pages, nextPage string) *tview.Flex {
+	doneTable := tview.NewTable().SetSelectable(false, false)
+	doneTable.SetCell(0, 0, tview.NewTableCell("Scan results exported to:").SetTextColor(tcell.ColorBlue)).
+		SetCell(2, 0, tview.NewTableCell(fileName).SetTextColor(tcell.ColorGreen))
+
+	form := tview.NewForm().AddButton("OK", func() {
+		pages.SwitchToPage(nextPage)
+	})
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).AddItem(doneTable, 0, 1, false).AddItem(form, 0, 2, true)
+	return flex
+}
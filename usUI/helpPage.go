@@ -0,0 +1,54 @@
+// Create the help page listing keyboard shortcuts of the main page
+package usUI
+
+import (
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// Keyboard shortcuts of the main page: key, then what it does
+var helpKeys = [][2]string{
+	{"Up / Down", "move into the tree or the table"},
+	{"Left / Right", "switch between the tree and the table"},
+	{"Enter", "expand or collapse the directory (tree), display properties of the file/directory (table)"},
+	{"TAB", "switch between buttons"},
+	{"a", "switch between apparent size and size allocated on disk"},
+	{"s", "sort the table by the next column: size, name, modification time, items, type"},
+	{"o", "reverse the sort order"},
+	{"p", "switch percentages between shares of the parent directory and of the scanned directory"},
+	{"e", "list errors found while scanning"},
+	{"j", "export scan results as JSON or as an ncdu dump"},
+	{"r", "resume a stopped scan"},
+	{"F5", "read again the directory selected into the tree"},
+	{"ESC", "stop the running scan"},
+	{"?", "display this help"},
+	{"CTRL+C", "quit"},
+}
+
+// Create the help page
+//	- pages: holds all pages for this application
+//	- nextPage: reference of the next page
+func CreateHelpPage(pages *tview.Pages, nextPage string) *tview.Flex {
+	helpTitle := tview.NewTextView().SetScrollable(false).SetTextColor(tcell.ColorBlue).
+		SetText("Keyboard shortcuts")
+
+	helpTable := tview.NewTable().SetSelectable(true, false)
+	for i, helpKey := range helpKeys {
+		helpTable.SetCell(i, 0, tview.NewTableCell(helpKey[0]).SetTextColor(tcell.ColorGreen)).
+			SetCell(i, 1, tview.NewTableCell(" "+helpKey[1]))
+	}
+
+	// Leave the page with the OK button, or by selecting a shortcut
+	helpTable.SetSelectedFunc(func(row int, column int) {
+		pages.SwitchToPage(nextPage)
+	})
+	form := tview.NewForm().AddButton("OK", func() {
+		pages.SwitchToPage(nextPage)
+	})
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(helpTitle, 2, 1, false).
+		AddItem(helpTable, 0, 1, true).
+		AddItem(form, 3, 1, false)
+	return flex
+}
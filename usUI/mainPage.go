@@ -4,29 +4,55 @@
 package usUI
 
 import (
-	//"log"
+	"fmt"
+	"math"
 	"os"
-	"path"
 	"path/filepath"
-	"sort"
+	"strings"
 
 	"github.com/dustin/go-humanize"
 	"github.com/gdamore/tcell"
-	"github.com/orcaman/concurrent-map"
 	"github.com/rivo/tview"
+
+	usData "UsedSpace/usData"
 )
 
-// Structure to hold file/directory informations
-type FileDirStruct struct {
-	FullPath string
-	Size     uint64
-	IsDir    bool
+// Structure to hold display settings shared by main page components
+type ViewState struct {
+	UseDiskSize bool            // Display and sort by size allocated on disk instead of apparent size
+	ShareOfRoot bool            // Percentages and bars are shares of the scanned directory instead of the parent directory
+	CurrentDir  *usData.Node    // Directory displayed into the contents table
+	currentPath string          // Full path of CurrentDir, to find it back if it is removed (see existingDir)
+	ScanRunning bool            // Directories not fully scanned are being scanned, else the scan was stopped
+	ReadOnly    bool            // Browsing a snapshot: the filesystem is never accessed, nothing can be deleted
+	Baseline    *usData.DirTree // Previous scan compared with the displayed one, nil if not comparing
+
+	// Sort of the contents table, displayed into its title with the kind of percentages (refreshed with the table)
+	SortKey       SortKey
+	SortAscending bool
+	tableTitle    *tview.TextView
+
+	// Read a directory beyond the maximum depth when it is expanded, nil if directories can't be read (snapshot)
+	ScanDir func(dirNode *usData.Node)
+}
+
+// Structure to hold a row of the contents table
+type tableEntry struct {
+	node *usData.Node // Reference used by properties and delete pages (nil if removed since the previous scan)
+	info usData.Node  // Copy of node's informations (the scan may still update the node)
+
+	// Comparison with the previous scan (see ViewState.Baseline)
+	delta     int64 // Size difference since the previous scan
+	isNew     bool
+	isRemoved bool
 }
 
 // Create the header component
-func createUSMainPageHeader() *tview.Flex {
+//	- viewState: display settings of the main page
+func createUSMainPageHeader(viewState *ViewState) *tview.Flex {
 	treeTitleTable := tview.NewTextView().SetScrollable(false).SetText("Navigate").SetTextColor(tcell.ColorBlue)
-	listTitleTable := tview.NewTextView().SetScrollable(false).SetText("Select").SetTextColor(tcell.ColorBlue)
+	listTitleTable := tview.NewTextView().SetScrollable(false).SetText(tableTitleText(viewState)).SetTextColor(tcell.ColorBlue)
+	viewState.tableTitle = listTitleTable
 
 	return tview.NewFlex().
 		AddItem(treeTitleTable, 0, 1, false).
@@ -36,8 +62,9 @@ func createUSMainPageHeader() *tview.Flex {
 // Create the main page (navigation tree and contents table)
 //	- mainTable: table list containing selected folder's content
 //	- tree: navigation tree
-func SetUpMainPage(tree, mainTable tview.Primitive) *tview.Flex {
-	usMainPageHeader := createUSMainPageHeader()
+//	- viewState: display settings of the main page
+func SetUpMainPage(tree, mainTable tview.Primitive, viewState *ViewState) *tview.Flex {
+	usMainPageHeader := createUSMainPageHeader(viewState)
 	usMainPageContent := tview.NewFlex().
 		AddItem(tree, 0, 1, true).
 		AddItem(mainTable, 0, 1, false)
@@ -49,69 +76,155 @@ func SetUpMainPage(tree, mainTable tview.Primitive) *tview.Flex {
 
 // Add tree node for each file/directory into the selected directory from the tree
 //	- target: node representing the file/directory into the tree
-//	- fullPath: file/directory's full path to set into their node reference
-func AddNodes(target *tview.TreeNode, fullPath string) {
-	fileDir, err := os.Open(fullPath)
-	if err != nil {
-		//log.Fatalln("Failed to open directory: ", FullPath, ".\t Error: ", err)
-		panic("Failed to open directory: " + fullPath)
+//	- dirNode: scanned directory to set into their node reference
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func AddNodes(target *tview.TreeNode, dirNode *usData.Node, dirTree *usData.DirTree, viewState *ViewState) {
+
+	// Create the node of each direct children files and directories of the scanned directory
+	for _, child := range dirTree.Children(dirNode) {
+		target.AddChild(newTreeNode(child, dirTree, viewState))
 	}
-	defer fileDir.Close()
+}
 
-	// Read all direct children files and directories from the given path and create their correponding node into the tree
-	fileDirList, _ := fileDir.Readdirnames(0)
-	for _, fileDirName := range fileDirList {
-		crtFullPath := filepath.Join(fullPath, fileDirName)
-		fileDirDescription, _ := os.Lstat(crtFullPath)
-		crtSize := uint64(fileDirDescription.Size())
+// Refresh expanded tree nodes while the scan is running: add new children and mark directories still being scanned
+//	- target: node representing the directory into the tree
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func RefreshNodes(target *tview.TreeNode, dirTree *usData.DirTree, viewState *ViewState) {
+	dirNode := target.GetReference().(*usData.Node)
+	if dirNode != dirTree.Root {
+		target.SetText(treeNodeText(dirTree.Stat(dirNode), dirTree, viewState))
+	}
+	if !target.IsExpanded() {
+		return
+	}
 
-		// Size from LStat for directory is wrong
-		if fileDirDescription.IsDir() {
-			crtSize = uint64(0)
+	// Keep children still into the tree (deleted ones are removed), add children found since the last refresh
+	children := dirTree.Children(dirNode)
+	currentNodes := make(map[*usData.Node]bool)
+	for _, child := range children {
+		currentNodes[child] = true
+	}
+	existingNodes := make(map[*usData.Node]bool)
+	keptChildren := []*tview.TreeNode{}
+	for _, child := range target.GetChildren() {
+		existingNodes[child.GetReference().(*usData.Node)] = true
+		if currentNodes[child.GetReference().(*usData.Node)] {
+			keptChildren = append(keptChildren, child)
 		}
+	}
+	for _, child := range children {
+		if !existingNodes[child] {
+			keptChildren = append(keptChildren, newTreeNode(child, dirTree, viewState))
+		}
+	}
+	target.SetChildren(keptChildren)
+
+	// Directories are refreshed with their children, files only need their weight to be updated
+	for _, child := range keptChildren {
+		childInfo := dirTree.Stat(child.GetReference().(*usData.Node))
+		if childInfo.IsDir {
+			RefreshNodes(child, dirTree, viewState)
+		} else {
+			child.SetText(treeNodeText(childInfo, dirTree, viewState))
+		}
+	}
+}
 
-		// Create the node of each file/directory, set directory selectable
-		crtNode := tview.NewTreeNode(fileDirName).
-			SetReference(FileDirStruct{crtFullPath, crtSize, fileDirDescription.IsDir()}).
-			SetSelectable(fileDirDescription.IsDir())
+// Create the tree node of a file/directory
+//	- child: scanned file/directory to set into the node reference
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func newTreeNode(child *usData.Node, dirTree *usData.DirTree, viewState *ViewState) *tview.TreeNode {
+
+	// Create the node of the file/directory, set directory selectable (mount points and excluded directories were not scanned, they can't be expanded)
+	info := dirTree.Stat(child) // Copy: the scan may still update the node
+	crtNode := tview.NewTreeNode(treeNodeText(info, dirTree, viewState)).
+		SetReference(child).
+		SetSelectable(info.IsDir && !info.IsMountPoint && !info.IsExcluded)
+
+	// Directories are colored into green, mount points into yellow, excluded files/directories into grey
+	if info.IsExcluded {
+		crtNode.SetColor(tcell.ColorGray)
+	} else if info.IsMountPoint {
+		crtNode.SetColor(tcell.ColorYellow)
+	} else if info.IsDir {
+		crtNode.SetColor(tcell.ColorGreen).SetExpanded(false)
+	}
 
-		// Directories are colored into green
-		if fileDirDescription.IsDir() {
-			crtNode.SetColor(tcell.ColorGreen).SetExpanded(false)
-		}
+	return crtNode
+}
+
+// Return the text displayed into the tree for a file/directory: its weight and name, marked if it was not fully scanned
+//	- info: copy of the file/directory's node
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func treeNodeText(info usData.Node, dirTree *usData.DirTree, viewState *ViewState) string {
+	nodeText := info.Name
+	if share, ok := nodeShare(info, dirTree, viewState); ok {
+		nodeText = percentText(share) + " " + nodeText
+	}
+	if info.LinkTarget != "" {
+		nodeText += " -> " + info.LinkTarget
+	}
+	if info.IsDeferred {
+		nodeText += " (not computed)"
+	}
+	if info.IsDir && !info.ScanDone {
+		nodeText += scanStateText(viewState)
+	}
+	if info.HasErrors {
+		nodeText += " (read errors)"
+	}
+	return nodeText
+}
 
-		target.AddChild(crtNode)
+// Return the mark of directories not fully scanned: still being scanned, or incomplete if the scan was stopped
+//	- viewState: display settings of the main page
+func scanStateText(viewState *ViewState) string {
+	if viewState.ScanRunning {
+		return " (scanning...)"
 	}
+	return " (incomplete)"
 }
 
 // Update table containing detailed list of files and directories children of the selected directory from the tree
 //	- tree: navigation tree
 //	- mainTable: table list containing selected folder's content
 //	- pages: holds all pages for this application
-//	- fileDirData: will holds informations about file/directory
-//	- givenPath: selected directory's path
-func SetNodeSelected(tree *tview.TreeView, mainTable *tview.Table, pages *tview.Pages, fileDirData cmap.ConcurrentMap, givenPath string) {
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func SetNodeSelected(tree *tview.TreeView, mainTable *tview.Table, pages *tview.Pages, dirTree *usData.DirTree, viewState *ViewState) {
 
 	tree.SetSelectedFunc(func(selectedNode *tview.TreeNode) {
 
-		nodeReference := selectedNode.GetReference()
+		nodeReference := selectedNode.GetReference().(*usData.Node)
 
-		// If the file/directory not exist anymore
-		if _, err := os.Lstat(nodeReference.(FileDirStruct).FullPath); os.IsNotExist(err) {
+		// If the file/directory not exist anymore (a snapshot is browsed as it was saved)
+		if !viewState.ReadOnly {
+			fullPath := dirTree.FullPath(nodeReference)
+			if _, err := os.Lstat(fullPath); os.IsNotExist(err) {
 
-			// Display error page
-			notExistPage := createNotExistPage(nodeReference.(FileDirStruct).FullPath, pages, "mainPage")
-			pages.RemovePage("notExistPage")
-			pages.AddAndSwitchToPage("notExistPage", notExistPage, true)
-			return
+				// Display error page
+				notExistPage := createNotExistPage(fullPath, pages, "mainPage")
+				pages.RemovePage("notExistPage")
+				pages.AddAndSwitchToPage("notExistPage", notExistPage, true)
+				return
+			}
+		}
+
+		// A directory beyond the maximum depth is read when it is expanded (its content is displayed while it is found)
+		if dirTree.Stat(nodeReference).IsDeferred && viewState.ScanDir != nil && !viewState.ScanRunning && !selectedNode.IsExpanded() {
+			viewState.ScanDir(nodeReference)
 		}
 
 		// Display informations about files and subdirectories under the selected directory
-		UpdateTableChildren(mainTable, pages, fileDirData, nodeReference.(FileDirStruct).FullPath, givenPath)
+		UpdateTableChildren(mainTable, pages, dirTree, nodeReference, viewState)
 
 		// Refresh children nodes of the selected directory (to be always updated)
 		selectedNode.ClearChildren()
-		AddNodes(selectedNode, nodeReference.(FileDirStruct).FullPath)
+		AddNodes(selectedNode, nodeReference, dirTree, viewState)
 		selectedNode.SetExpanded(!selectedNode.IsExpanded())
 	})
 }
@@ -119,101 +232,307 @@ func SetNodeSelected(tree *tview.TreeView, mainTable *tview.Table, pages *tview.
 // Refresh table content to update files and directories list (at selection or after file/directory deletion)
 //	- mainTable: table list containing selected folder's content
 //	- pages: holds all pages for this application
-//	- fileDirData: will holds informations about file/directory
-//	- dirPath: parent directory's path of the selected file/directory
-//	- givenPath: selected file/directory's path
-func UpdateTableChildren(mainTable *tview.Table, pages *tview.Pages, fileDirData cmap.ConcurrentMap, dirPath string, givenPath string) {
+//	- dirTree: holds informations about scanned file/directory
+//	- dirNode: parent directory of the selected file/directory
+//	- viewState: display settings of the main page
+func UpdateTableChildren(mainTable *tview.Table, pages *tview.Pages, dirTree *usData.DirTree, dirNode *usData.Node, viewState *ViewState) {
+
+	// The displayed directory was removed since (by another process, see --watch, or read again): display it again, or its nearest existing ancestor
+	if dirNode == viewState.CurrentDir && !dirExists(dirNode, dirTree, viewState) {
+		dirNode = existingDir(viewState.currentPath, dirTree, viewState)
+	}
 
 	// If the parent directory doesn't exist, do nothing
-	_, err := os.Lstat(dirPath)
-	if err != nil {
+	if !dirExists(dirNode, dirTree, viewState) {
 		return
 	}
 
 	mainTable.Clear()
+	viewState.CurrentDir, viewState.currentPath = dirNode, dirTree.FullPath(dirNode) // Keep it to refresh the table when display settings change
 
-	directChildrenSlice, haveChild := getDirectChildrenDir(dirPath, fileDirData)
-
-	if haveChild {
-		for i := 0; i < len(directChildrenSlice); i++ {
-			fileDirSet, _ := fileDirData.Get(directChildrenSlice[i].FullPath)
-			fp := fileDirSet.(FileDirStruct).FullPath
-			fileDirStat, _ := os.Lstat(fp)
+	directChildrenSlice := getDirectChildrenDir(dirNode, dirTree)
+	if viewState.Baseline != nil {
+		directChildrenSlice = getDiffChildrenDir(dirNode, dirTree, viewState.Baseline, viewState.UseDiskSize)
+	}
+	sortEntries(directChildrenSlice, viewState)
+	if viewState.tableTitle != nil {
+		viewState.tableTitle.SetText(tableTitleText(viewState))
+	}
 
-			textColor := tcell.ColorWhite
-			if fileDirSet.(FileDirStruct).IsDir {
-				textColor = tcell.ColorGreen
+	for i, child := range directChildrenSlice {
+		textColor := tcell.ColorWhite
+		nameText := child.info.Name
+		if child.info.LinkTarget != "" {
+			nameText += " -> " + child.info.LinkTarget
+		}
+		sizeText := humanize.Bytes(child.info.DisplaySize(viewState.UseDiskSize))
+		shareText := ""
+		if share, ok := nodeShare(child.info, dirTree, viewState); ok && !child.isRemoved {
+			shareText = percentText(share) + " " + barText(share)
+		}
+		itemsText := ""
+		if child.info.IsDir && !child.info.IsMountPoint && !child.info.IsDeferred {
+			itemsText = humanize.Comma(int64(child.info.Items)) + " item"
+			if child.info.Items >= 2 {
+				itemsText += "s"
 			}
+		}
+		if child.isRemoved {
+			textColor = tcell.ColorGray
+			nameText += " (removed)"
+			sizeText, itemsText = "0 B", ""
+		} else if child.info.IsExcluded {
+			textColor = tcell.ColorGray
+			sizeText, itemsText = "excluded", ""
+		} else if child.info.IsMountPoint {
+			textColor = tcell.ColorYellow
+			sizeText = "mount point"
+		} else if child.info.IsDeferred {
+			textColor = tcell.ColorGreen
+			sizeText = "not yet computed"
+		} else if child.info.IsDir {
+			textColor = tcell.ColorGreen
+
+			// Size is still growing until the whole subtree was read (or is a lower bound if the scan was stopped)
+			if !child.info.ScanDone {
+				sizeText += scanStateText(viewState)
+			}
+		}
 
-			mainTable.SetCell(i, 0, tview.NewTableCell(fileDirStat.Mode().String()).SetTextColor(textColor))
-			mainTable.SetCell(i, 1, tview.NewTableCell(path.Base(fp)).SetTextColor(textColor))
-			mainTable.SetCell(i, 2, tview.NewTableCell(humanize.Bytes(fileDirSet.(FileDirStruct).Size)).SetTextColor(textColor))
+		// Something inside couldn't be read, or was not read yet: size is a lower bound
+		lowerBound := child.info.HasDeferred && !child.info.IsDeferred && !child.isRemoved
+		if child.info.HasErrors && !child.isRemoved {
+			textColor = tcell.ColorRed
+			lowerBound = true
+		}
+		if lowerBound {
+			sizeText = ">= " + sizeText
+			if itemsText != "" {
+				itemsText = ">= " + itemsText
+			}
+		}
 
-			// Display detail page about the selected file/directory from the table
-			mainTable.SetSelectedFunc(func(row int, column int) {
+		// Comparing with a previous scan: add the size difference
+		if viewState.Baseline != nil {
+			if child.isNew {
+				nameText += " (new)"
+			}
+			sizeText += " (" + deltaText(child.delta) + ")"
+		}
 
-				// If the file/directory doesn't exist anymore, create error page and do Return immediately
-				_, err := os.Lstat(fp)
-				if err != nil {
-					notExistPage := createNotExistPage(fp, pages, "mainPage")
-					pages.RemovePage("notExistPage")
-					pages.AddAndSwitchToPage("notExistPage", notExistPage, true)
-					return
-				}
+		mainTable.SetCell(i, 0, tview.NewTableCell(child.info.Mode.String()).SetTextColor(textColor))
+		mainTable.SetCell(i, 1, tview.NewTableCell(nameText).SetTextColor(textColor))
+		mainTable.SetCell(i, 2, tview.NewTableCell(sizeText).SetTextColor(textColor))
+		mainTable.SetCell(i, 3, tview.NewTableCell(shareText).SetTextColor(textColor))
+		mainTable.SetCell(i, 4, tview.NewTableCell(itemsText).SetTextColor(textColor).SetAlign(tview.AlignRight))
+	}
 
-				// Create/Refresh file/directory properties page
-				usPropPage := CreatePropPage(directChildrenSlice[row], "mainPage", pages, fileDirData, mainTable, givenPath)
+	// Display detail page about the selected file/directory from the table
+	mainTable.SetSelectedFunc(func(row int, column int) {
+		if row >= len(directChildrenSlice) || directChildrenSlice[row].isRemoved {
+			return
+		}
+		fp := dirTree.FullPath(directChildrenSlice[row].node)
+
+		// If the file/directory doesn't exist anymore, create error page and do Return immediately
+		if !viewState.ReadOnly {
+			if _, err := os.Lstat(fp); err != nil {
+				notExistPage := createNotExistPage(fp, pages, "mainPage")
+				pages.RemovePage("notExistPage")
+				pages.AddAndSwitchToPage("notExistPage", notExistPage, true)
+				return
+			}
+		}
 
-				// No way to refresh, so delete and create
-				pages.RemovePage("propertiesPage")
-				pages.AddAndSwitchToPage("propertiesPage", usPropPage, true)
-			})
+		// Create/Refresh file/directory properties page
+		usPropPage, err := CreatePropPage(directChildrenSlice[row].node, "mainPage", pages, dirTree, mainTable, viewState)
+		if err != nil {
+			ShowErrorPage(fp, "can't be read", err, pages, "mainPage")
+			return
 		}
+
+		// No way to refresh, so delete and create
+		pages.RemovePage("propertiesPage")
+		pages.AddAndSwitchToPage("propertiesPage", usPropPage, true)
+	})
+}
+
+// Return direct children files and directories list of the directory given in parameter (see sortEntries)
+//	- dirNode: directory to get children
+//	- dirTree: holds informations about scanned file/directory
+func getDirectChildrenDir(dirNode *usData.Node, dirTree *usData.DirTree) []tableEntry {
+	directChildrenSlice := []tableEntry{}
+	for _, child := range dirTree.Children(dirNode) {
+		directChildrenSlice = append(directChildrenSlice, tableEntry{node: child, info: dirTree.Stat(child)})
 	}
 
+	return directChildrenSlice
 }
 
-// Return direct children files and directories list for the path given in parameter
-//	- dirPath: directory's path to get children
-//	- cDirFilesMap: will holds informations about file/directory
-func getDirectChildrenDir(dirPath string, cDirFilesMap cmap.ConcurrentMap) ([]FileDirStruct, bool) {
+// Return direct children files and directories list of the directory compared with a previous scan, removed ones included (see sortEntries)
+//	- dirNode: directory to get children
+//	- dirTree: holds informations about scanned file/directory
+//	- baseline: holds informations about the previous scan
+//	- useDiskSize: compare sizes allocated on disk instead of apparent sizes
+func getDiffChildrenDir(dirNode *usData.Node, dirTree *usData.DirTree, baseline *usData.DirTree, useDiskSize bool) []tableEntry {
+	directChildrenSlice := []tableEntry{}
+	for _, entry := range dirTree.DiffChildren(dirNode, baseline) {
+		directChildrenSlice = append(directChildrenSlice, tableEntry{
+			node:      entry.Node,
+			info:      entry.Info,
+			delta:     entry.Delta(useDiskSize),
+			isNew:     entry.IsNew,
+			isRemoved: entry.IsRemoved,
+		})
+	}
 
-	directChildrenSlice := make([]FileDirStruct, 1)
-	childExist := false
-	for _, k := range cDirFilesMap.Keys() {
-		if path.Dir(k) == dirPath {
-			fileDirSet, _ := cDirFilesMap.Get(k)
+	return directChildrenSlice
+}
 
-			// Initialize first slice's data
-			if !childExist {
-				directChildrenSlice[0], _ = fileDirSet.(FileDirStruct)
-				childExist = true
-			} else {
-				directChildrenSlice = append(directChildrenSlice, fileDirSet.(FileDirStruct))
-			}
+// Return the title of the contents table: how it is sorted, and what percentages are shares of
+//	- viewState: display settings of the main page
+func tableTitleText(viewState *ViewState) string {
+	shareText := "% of parent"
+	if viewState.ShareOfRoot {
+		shareText = "% of scanned directory"
+	}
+	return "Select (" + sortText(viewState) + ", " + shareText + ")"
+}
+
+// Return the share of a file/directory into its parent directory, or into the scanned directory (see ViewState.ShareOfRoot)
+// The scanned directory itself and files/directories whose size is not counted into their parents have none
+//	- info: copy of the file/directory's node
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func nodeShare(info usData.Node, dirTree *usData.DirTree, viewState *ViewState) (float64, bool) {
+	if info.Parent == nil || info.IsExcluded || info.IsMountPoint || info.IsDeferred || info.IsLinkDuplicate {
+		return 0, false
+	}
+
+	totalInfo := dirTree.Stat(info.Parent)
+	if viewState.ShareOfRoot {
+		totalInfo = dirTree.Stat(dirTree.Root)
+	}
+	total := totalInfo.DisplaySize(viewState.UseDiskSize)
+	if total == 0 {
+		return 0, true
+	}
+	return math.Min(float64(info.DisplaySize(viewState.UseDiskSize))/float64(total), 1), true
+}
+
+// Return the displayed percentage of a share, always 6 characters wide to keep names aligned
+//	- share: share from 0 to 1
+func percentText(share float64) string {
+	return fmt.Sprintf("%5.1f%%", share*100)
+}
+
+// Return the bar graph of a share, like ncdu: [#####     ]
+//	- share: share from 0 to 1
+func barText(share float64) string {
+	const barWidth = 10
+	filled := int(math.Round(share * barWidth))
+	return tview.Escape("[" + strings.Repeat("#", filled) + strings.Repeat(" ", barWidth-filled) + "]")
+}
+
+// Return the absolute value of a size difference
+//	- delta: size difference
+func absDelta(delta int64) int64 {
+	if delta < 0 {
+		return -delta
+	}
+	return delta
+}
+
+// Return the displayed size difference, always signed
+//	- delta: size difference
+func deltaText(delta int64) string {
+	if delta < 0 {
+		return "-" + humanize.Bytes(uint64(-delta))
+	}
+	return "+" + humanize.Bytes(uint64(delta))
+}
+
+// Return true if the directory is still into the tree, and still on disk (a snapshot is browsed as it was saved)
+//	- dirNode: directory's node
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func dirExists(dirNode *usData.Node, dirTree *usData.DirTree, viewState *ViewState) bool {
+	if !dirTree.Contains(dirNode) {
+		return false
+	}
+	if viewState.ReadOnly {
+		return true
+	}
+	_, err := os.Lstat(dirTree.FullPath(dirNode))
+	return err == nil
+}
+
+// Return the directory having the given path, or its nearest ancestor still existing (the scanned directory at last)
+//	- dirPath: full path of the directory
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func existingDir(dirPath string, dirTree *usData.DirTree, viewState *ViewState) *usData.Node {
+	for {
+		if dirNode := dirTree.Lookup(dirPath); dirNode != nil && dirExists(dirNode, dirTree, viewState) {
+			return dirNode
+		}
+		parentPath := filepath.Dir(dirPath)
+		if parentPath == dirPath {
+			return dirTree.Root
 		}
+		dirPath = parentPath
 	}
+}
 
-	// Sort result by size
-	sort.Slice(directChildrenSlice, func(i, j int) bool { return directChildrenSlice[i].Size > directChildrenSlice[j].Size })
+// Select the directory displayed into the table into the tree when the selected tree node was removed (see UpdateTableChildren),
+// or its nearest ancestor displayed into the tree, and display its path into the header
+//	- tree: navigation tree
+//	- headerInfo: header component to display full path of selected directory from the tree
+//	- dirTree: holds informations about scanned file/directory
+//	- viewState: display settings of the main page
+func FollowCurrentDir(tree *tview.TreeView, headerInfo *tview.Table, dirTree *usData.DirTree, viewState *ViewState) {
+	currentNode := tree.GetCurrentNode()
+	if viewState.CurrentDir == nil || currentNode != nil && dirTree.Contains(currentNode.GetReference().(*usData.Node)) {
+		return
+	}
 
-	return directChildrenSlice, childExist
+	// Visible tree nodes: children of expanded directories
+	treeNodes := make(map[*usData.Node]*tview.TreeNode)
+	tree.GetRoot().Walk(func(node, parent *tview.TreeNode) bool {
+		treeNodes[node.GetReference().(*usData.Node)] = node
+		return node.IsExpanded()
+	})
+	for dirNode := viewState.CurrentDir; dirNode != nil; dirNode = dirTree.Stat(dirNode).Parent {
+		if treeNode, ok := treeNodes[dirNode]; ok {
+			tree.SetCurrentNode(treeNode)
+			showPath(headerInfo, dirTree.FullPath(dirNode))
+			return
+		}
+	}
 }
 
 // Update header when user navigate into the tree
 //	- tree: navigation tree
 //	- headerInfo: header component to display full path of selected directory from the tree
-func OnNodeChanged(tree *tview.TreeView, headerInfo *tview.Table) {
+//	- dirTree: holds informations about scanned file/directory
+func OnNodeChanged(tree *tview.TreeView, headerInfo *tview.Table, dirTree *usData.DirTree) {
 	tree.SetChangedFunc(func(focusedNode *tview.TreeNode) {
 		nodeReference := focusedNode.GetReference()
 
 		if nodeReference != nil {
-			headerInfo.Clear()
-			headerInfo.SetCell(0, 0, tview.NewTableCell(nodeReference.(FileDirStruct).FullPath).SetTextColor(tcell.ColorGreen))
+			showPath(headerInfo, dirTree.FullPath(nodeReference.(*usData.Node)))
 		}
 	})
 }
 
+// Display the full path of the selected directory into the header
+//	- headerInfo: header component
+//	- fullPath: full path of the selected directory
+func showPath(headerInfo *tview.Table, fullPath string) {
+	headerInfo.Clear()
+	headerInfo.SetCell(0, 0, tview.NewTableCell(fullPath).SetTextColor(tcell.ColorGreen))
+}
+
 // Display error page when a selected folder not exist anymore
 //	- fullPath: full path of the missing file/directory
 //	- pages: holds all pages for this application
@@ -0,0 +1,96 @@
+// Create the scan progress view:
+//	- counters of files, directories and bytes found
+//	- throughput, elapsed time and errors
+//	- directory being read
+//	- informations about the opened snapshot
+//	- state of the watcher
+package usUI
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+
+	usData "UsedSpace/usData"
+	usWalk "UsedSpace/usWalk"
+)
+
+// Create the progress view, filled by UpdateProgressView while the scan is running
+func CreateProgressView() *tview.Table {
+	return tview.NewTable().SetSelectable(false, false)
+}
+
+// Refresh the progress view with the latest scan counters
+//	- progressView: progress view to refresh
+//	- counters: copy of the scan counters
+func UpdateProgressView(progressView *tview.Table, counters usWalk.ScanCounters) {
+	progressView.Clear()
+
+	state := "Scanning"
+	stateColor := tcell.ColorYellow
+	if counters.Cancelled {
+		state = "Scan stopped, results are incomplete ('r' to resume)"
+		stateColor = tcell.ColorRed
+	} else if !counters.EndTime.IsZero() {
+		state = "Scan done"
+		stateColor = tcell.ColorGreen
+	}
+
+	errorsColor := tcell.ColorWhite
+	if counters.Errors > 0 {
+		errorsColor = tcell.ColorRed
+	}
+
+	progressView.
+		SetCell(0, 0, tview.NewTableCell(state).SetTextColor(stateColor)).
+		SetCell(0, 1, tview.NewTableCell(" Files: "+humanize.Comma(int64(counters.Files)))).
+		SetCell(0, 2, tview.NewTableCell(" Directories: "+humanize.Comma(int64(counters.Dirs)))).
+		SetCell(0, 3, tview.NewTableCell(" Size: "+humanize.Bytes(counters.Bytes))).
+		SetCell(0, 4, tview.NewTableCell(" Errors: "+strconv.FormatUint(counters.Errors, 10)).SetTextColor(errorsColor)).
+		SetCell(0, 5, tview.NewTableCell(" Speed: "+humanize.Comma(int64(counters.EntriesPerSecond()))+" entries/s")).
+		SetCell(0, 6, tview.NewTableCell(" Elapsed: "+counters.Elapsed().Round(time.Second).String()))
+
+	// Directory being read, useful to tell a slow scan from a hung one
+	if counters.EndTime.IsZero() {
+		progressView.SetCell(1, 0, tview.NewTableCell("Reading").SetTextColor(stateColor)).
+			SetCell(1, 1, tview.NewTableCell(" "+counters.CurrentPath).SetExpansion(1))
+	}
+}
+
+// Display informations about the opened snapshot instead of the scan progress
+//	- progressView: progress view to fill
+//	- fileName: path of the snapshot file
+//	- dirTree: holds informations about file/directory loaded from the snapshot
+func UpdateSnapshotView(progressView *tview.Table, fileName string, dirTree *usData.DirTree) {
+	progressView.Clear()
+
+	rootInfo := dirTree.Stat(dirTree.Root)
+	errorsColor := tcell.ColorWhite
+	if rootInfo.HasErrors {
+		errorsColor = tcell.ColorRed
+	}
+
+	progressView.
+		SetCell(0, 0, tview.NewTableCell("Snapshot (read-only)").SetTextColor(tcell.ColorGreen)).
+		SetCell(0, 1, tview.NewTableCell(" File: "+fileName)).
+		SetCell(0, 2, tview.NewTableCell(" Items: "+humanize.Comma(int64(rootInfo.Items)))).
+		SetCell(0, 3, tview.NewTableCell(" Size: "+humanize.Bytes(rootInfo.Size))).
+		SetCell(0, 4, tview.NewTableCell(" Errors: "+strconv.Itoa(len(dirTree.Errors()))).SetTextColor(errorsColor))
+}
+
+// Display the state of the watcher below the scan summary
+//	- progressView: progress view to fill
+//	- watched: number of watched directories
+//	- err: last error of the watcher, after which some changes are missed (nil if none)
+func UpdateWatchView(progressView *tview.Table, watched int, err error) {
+	if err != nil {
+		progressView.SetCell(1, 0, tview.NewTableCell("Watching").SetTextColor(tcell.ColorRed)).
+			SetCell(1, 1, tview.NewTableCell(" "+err.Error()).SetExpansion(1))
+		return
+	}
+	progressView.SetCell(1, 0, tview.NewTableCell("Watching").SetTextColor(tcell.ColorGreen)).
+		SetCell(1, 1, tview.NewTableCell(" "+humanize.Comma(int64(watched))+" directories, changes made by other processes are applied").SetExpansion(1))
+}
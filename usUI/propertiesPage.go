@@ -7,102 +7,124 @@ package usUI
 import (
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/djherbis/times"
 	"github.com/dustin/go-humanize"
 	"github.com/gdamore/tcell"
-	"github.com/orcaman/concurrent-map"
 	"github.com/rivo/tview"
+
+	usData "UsedSpace/usData"
 )
 
 // Create properties page for selected files/directories
 //	- fileDir: holds data of the file/directory to get properties
 //	- nextPage: reference of the next page
 //	- pages: holds all pages for this application
-//	- fileDirData: will holds informations about file/directory
+//	- dirTree: holds informations about scanned file/directory
 //	- mainTable: table list containing selected folder's content
-//	- givenPath: directory's path to scan
-func CreatePropPage(fileDir FileDirStruct, nextPage string, pages *tview.Pages, fileDirData cmap.ConcurrentMap, mainTable *tview.Table, givenPath string) *tview.Flex {
+//	- viewState: display settings of the main page
+func CreatePropPage(fileDir *usData.Node, nextPage string, pages *tview.Pages, dirTree *usData.DirTree, mainTable *tview.Table, viewState *ViewState) (*tview.Flex, error) {
 	propTable := tview.NewTable().SetSelectable(false, false)
 
-	fdInfo := getFileDirInfo(fileDir)
+	fileDirInfo := dirTree.Stat(fileDir) // Copy: the scan may still update the node
+	fdInfo, err := getFileDirInfo(&fileDirInfo, dirTree, viewState.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
 	propTable.
 		//SetCell(0, 0, tview.NewTableCell(" Full Path").SetTextColor(tcell.ColorGreen)).SetCellSimple(0, 1, ": "+fdInfo["fullPath"]).
 		SetCell(0, 0, tview.NewTableCell(" Name").SetTextColor(tcell.ColorGreen)).SetCellSimple(0, 1, ": "+fdInfo["name"]).
 		SetCell(1, 0, tview.NewTableCell(" Type").SetTextColor(tcell.ColorGreen)).SetCellSimple(1, 1, ": "+fdInfo["type"]).
 		SetCell(2, 0, tview.NewTableCell(" Parent Folder").SetTextColor(tcell.ColorGreen)).SetCellSimple(2, 1, ": "+fdInfo["parent"]).
 		SetCell(3, 0, tview.NewTableCell(" Size").SetTextColor(tcell.ColorGreen)).SetCellSimple(3, 1, ": "+fdInfo["size"]).
-		SetCell(4, 0, tview.NewTableCell(" Last Access").SetTextColor(tcell.ColorGreen)).SetCellSimple(4, 1, ": "+fdInfo["accessTime"]).
-		SetCell(5, 0, tview.NewTableCell(" Last Modification").SetTextColor(tcell.ColorGreen)).SetCellSimple(5, 1, ": "+fdInfo["modTime"])
+		SetCell(4, 0, tview.NewTableCell(" Disk Usage").SetTextColor(tcell.ColorGreen)).SetCellSimple(4, 1, ": "+fdInfo["diskSize"]).
+		SetCell(5, 0, tview.NewTableCell(" Last Access").SetTextColor(tcell.ColorGreen)).SetCellSimple(5, 1, ": "+fdInfo["accessTime"]).
+		SetCell(6, 0, tview.NewTableCell(" Last Modification").SetTextColor(tcell.ColorGreen)).SetCellSimple(6, 1, ": "+fdInfo["modTime"])
+
+	// Add Contents row for directory object, Hard Links row for files
+	if fileDirInfo.IsDir {
+		propTable.SetCell(7, 0, tview.NewTableCell(" Contents").SetTextColor(tcell.ColorGreen)).SetCellSimple(7, 1, ": "+fdInfo["content"])
+	} else {
+		propTable.SetCell(7, 0, tview.NewTableCell(" Hard Links").SetTextColor(tcell.ColorGreen)).SetCellSimple(7, 1, ": "+fdInfo["links"])
+	}
 
-	// Add Contents row for directory object
-	if fileDir.IsDir {
-		propTable.SetCell(5, 0, tview.NewTableCell(" Contents").SetTextColor(tcell.ColorGreen)).SetCellSimple(5, 1, ": "+fdInfo["content"])
+	// Add Link Target and Target Size rows for symbolic links
+	row := 8
+	if linkTarget, ok := fdInfo["linkTarget"]; ok {
+		propTable.SetCell(row, 0, tview.NewTableCell(" Link Target").SetTextColor(tcell.ColorGreen)).SetCellSimple(row, 1, ": "+linkTarget).
+			SetCell(row+1, 0, tview.NewTableCell(" Target Size").SetTextColor(tcell.ColorGreen)).SetCellSimple(row+1, 1, ": "+fdInfo["targetSize"])
+		row += 2
+	}
+
+	// Add Read Errors row if the file/directory, or something inside, couldn't be read
+	if fileDirInfo.HasErrors {
+		readErrors := "some files/directories inside couldn't be read, sizes are lower bounds"
+		if fileDirInfo.Err != nil {
+			readErrors = fileDirInfo.Err.Error()
+		}
+		propTable.SetCell(row, 0, tview.NewTableCell(" Read Errors").SetTextColor(tcell.ColorRed)).SetCellSimple(row, 1, ": "+readErrors)
 	}
 
 	form := tview.NewForm().
 		AddButton("OK", func() {
 			pages.SwitchToPage(nextPage)
-		}).
-		AddButton("Delete", func() {
+		})
+
+	// Mount points were not scanned, never delete another filesystem's content from here (nor anything from a snapshot)
+	if !fileDir.IsMountPoint && !viewState.ReadOnly {
+		form.AddButton("Delete", func() {
 
 			// Create confirm delete page
-			delPage := createDelPage(fileDir, "propertiesPage", pages, fileDirData, mainTable, givenPath)
+			delPage := createDelPage(fileDir, "propertiesPage", pages, dirTree, mainTable, viewState)
 
 			// No way to refresh, so delete and create
 			pages.RemovePage("confirmDelPage")
 			pages.AddAndSwitchToPage("confirmDelPage", delPage, true)
 		})
+	}
 
 	propTitle := tview.NewTextView().SetScrollable(false).SetText("Properties").SetTextColor(tcell.ColorBlue)
 
 	flex := tview.NewFlex().SetDirection(tview.FlexRow).AddItem(propTitle, 2, 1, false).AddItem(propTable, 0, 1, false).AddItem(form, 0, 2, true)
 
-	return flex
+	return flex, nil
 }
 
 // Create delete page confirmation, delete the file/directory and update stored data
 //	- fileDir: holds data of the file/directory to get properties
 //	- nextPage: reference of the next page
 //	- pages: holds all pages for this application
-//	- fileDirData: will holds informations about file/directory
+//	- dirTree: holds informations about scanned file/directory
 //	- mainTable: table list containing selected folder's content (to be updated)
-//	- givenPath: path of the scanned directory
-func createDelPage(fileDir FileDirStruct, nextPage string, pages *tview.Pages, fileDirData cmap.ConcurrentMap, mainTable *tview.Table, givenPath string) *tview.Flex {
+//	- viewState: display settings of the main page
+func createDelPage(fileDir *usData.Node, nextPage string, pages *tview.Pages, dirTree *usData.DirTree, mainTable *tview.Table, viewState *ViewState) *tview.Flex {
+	fullPath := dirTree.FullPath(fileDir)
 	delTable := tview.NewTable().SetSelectable(false, false)
 	delTable.SetCell(0, 0, tview.NewTableCell("Are you sure to delete: ").SetTextColor(tcell.ColorRed)).
-		SetCell(2, 0, tview.NewTableCell(fileDir.FullPath))
+		SetCell(2, 0, tview.NewTableCell(fullPath))
 
 	form := tview.NewForm().AddButton("OK", func() {
 
 		// Delete the file/directory
-		err := os.Remove(fileDir.FullPath)
-		if fileDir.IsDir {
-			err = os.RemoveAll(fileDir.FullPath)
+		fileDirInfo := dirTree.Stat(fileDir) // Copy: the scan may still update the node
+		err := os.Remove(fullPath)
+		if fileDirInfo.IsDir {
+			err = os.RemoveAll(fullPath)
 		}
 
 		if err != nil {
-			//panic(err)
-			errorPage := createErrorPage(fileDir, err.Error(), pages, "propertiesPage")
-			pages.RemovePage("errorPage")
-			pages.AddAndSwitchToPage("errorPage", errorPage, true)
+			ShowErrorPage(fullPath, "can't be removed", err, pages, "propertiesPage")
 		} else {
 
-			// Update all directories Size
-			currentParent := fileDir.FullPath
-			for currentParent != givenPath {
-				currentParent = path.Dir(currentParent)
-
-				currentParentObj, _ := fileDirData.Get(currentParent)
-				currentParentSize := currentParentObj.(FileDirStruct).Size
-				fileDirData.Set(currentParent, FileDirStruct{currentParent, currentParentSize - fileDir.Size, true})
-			}
-			fileDirData.Remove(fileDir.FullPath) // Remove its instance from memory
+			// Remove its instance from memory and update all directories Size
+			parentDir := fileDirInfo.Parent
+			dirTree.Remove(fileDir)
 
 			// Refresh file/directory table for the parent directory into main page then switch to it
-			UpdateTableChildren(mainTable, pages, fileDirData, path.Dir(fileDir.FullPath), givenPath)
+			UpdateTableChildren(mainTable, pages, dirTree, parentDir, viewState)
 			pages.SwitchToPage("mainPage")
 		}
 	}).
@@ -114,20 +136,36 @@ func createDelPage(fileDir FileDirStruct, nextPage string, pages *tview.Pages, f
 	return flex
 }
 
-// Create error page if a file/directory cannot be removed
-//	- fileDir: holds data of the file/directory to get properties
-//	- errorMsg: error message
+// Create and display error page if an action on a file/directory failed
+//	- fullPath: full path of the file/directory
+//	- action: description of the failed action (e.g. "can't be removed")
+//	- err: error returned by the action
 //	- pages: holds all pages for this application
 //	- nextPage: reference of the next page
-func createErrorPage(fileDir FileDirStruct, errorMsg string, pages *tview.Pages, nextPage string) *tview.Flex {
-	reason := strings.Split(errorMsg, ":")
-	if len(reason[1]) == 0 {
-		reason[1] = "Unknown Reason"
+func ShowErrorPage(fullPath string, action string, err error, pages *tview.Pages, nextPage string) {
+	errorPage := createErrorPage(fullPath, action, err, pages, nextPage)
+
+	// No way to refresh, so delete and create
+	pages.RemovePage("errorPage")
+	pages.AddAndSwitchToPage("errorPage", errorPage, true)
+}
+
+// Create error page if an action on a file/directory failed
+//	- fullPath: full path of the file/directory
+//	- action: description of the failed action
+//	- err: error returned by the action
+//	- pages: holds all pages for this application
+//	- nextPage: reference of the next page
+func createErrorPage(fullPath string, action string, err error, pages *tview.Pages, nextPage string) *tview.Flex {
+
+	reason := errorReason(err)
+	if len(reason) == 0 {
+		reason = "Unknown Reason"
 	}
 	errorTable := tview.NewTable().SetSelectable(false, false)
 	errorTable.SetCell(0, 0, tview.NewTableCell("Error!").SetTextColor(tcell.ColorRed)).
-		SetCell(2, 0, tview.NewTableCell(fileDir.FullPath)).
-		SetCell(3, 0, tview.NewTableCell("can't be removed : "+reason[1]).SetTextColor(tcell.ColorRed))
+		SetCell(2, 0, tview.NewTableCell(fullPath)).
+		SetCell(3, 0, tview.NewTableCell(action+" : "+reason).SetTextColor(tcell.ColorRed))
 
 	form := tview.NewForm().AddButton("OK", func() {
 		pages.SwitchToPage(nextPage)
@@ -137,54 +175,173 @@ func createErrorPage(fileDir FileDirStruct, errorMsg string, pages *tview.Pages,
 	return flex
 }
 
+// Return the reason of an error, without the path of errors about a path (it is already displayed)
+//	- err: error to display
+func errorReason(err error) string {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
 // Return more informations about a selected file/directory
 //	- fileDir: holds data of the file/directory to get properties
-func getFileDirInfo(fileDir FileDirStruct) map[string]string {
+//	- dirTree: holds informations about scanned file/directory
+//	- readOnly: browsing a snapshot, informations only come from the scanned node (the filesystem is never accessed)
+func getFileDirInfo(fileDir *usData.Node, dirTree *usData.DirTree, readOnly bool) (map[string]string, error) {
 	var fileDirInfo = make(map[string]string)
+	fullPath := dirTree.FullPath(fileDir)
+
+	//fileDirInfo["fullPath"] = fullPath
+	fileDirInfo["name"] = path.Base(fullPath)
+	fileDirInfo["size"] = humanize.Bytes(fileDir.Size)
+	fileDirInfo["diskSize"] = humanize.Bytes(fileDir.DiskSize)
+	fileDirInfo["links"] = strconv.FormatUint(fileDir.Links, 10)
+	if fileDir.IsLinkDuplicate {
+		fileDirInfo["links"] += " (size counted through another link)"
+	}
+	fileDirInfo["parent"] = path.Dir(fullPath)
+	switch {
+	case fileDir.IsExcluded:
+		fileDirInfo["size"] = "not scanned (excluded)"
+		fileDirInfo["diskSize"] = "not scanned (excluded)"
+	case fileDir.IsDeferred:
+		fileDirInfo["size"] = "not yet computed (expand the directory to read it)"
+		fileDirInfo["diskSize"] = "not yet computed"
+	case fileDir.HasDeferred:
+		fileDirInfo["size"] = ">= " + fileDirInfo["size"] + " (some subdirectories were not read yet)"
+		fileDirInfo["diskSize"] = ">= " + fileDirInfo["diskSize"]
+	}
+
+	if readOnly {
+		fileDirInfo["type"] = fileType(fileDir.Mode, fileDir.IsMountPoint)
+		fileDirInfo["accessTime"] = "unknown (snapshot)"
+		fileDirInfo["modTime"] = "unknown (snapshot)"
+		if !fileDir.ModTime.IsZero() {
+			fileDirInfo["modTime"] = timeText(fileDir.ModTime)
+		}
+		fileDirInfo["content"] = elementsText(len(fileDir.Children)) + subtreeText(fileDir)
+		if fileDir.LinkTarget != "" {
+			fileDirInfo["linkTarget"] = fileDir.LinkTarget
+			fileDirInfo["targetSize"] = humanize.Bytes(fileDir.Size) + " (followed)"
+		}
+		return fileDirInfo, nil
+	}
 
 	// Get time informations about the file/directory
-	fdInfoTime, _ := times.Stat(fileDir.FullPath)
-	accesTimeStr := fdInfoTime.AccessTime().String()
-	accesTimeDatePart := strings.Split(accesTimeStr, ".")[0]
-	accesTimeGMTPart := strings.Split(accesTimeStr, " ")[2] + " " + strings.Split(accesTimeStr, " ")[3]
-	modTimeStr := fdInfoTime.ModTime().String()
-	modTimeDatePart := strings.Split(modTimeStr, ".")[0]
-	modTimeGMTPart := strings.Split(modTimeStr, " ")[2] + " " + strings.Split(modTimeStr, " ")[3]
+	fdInfoTime, err := times.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	fileDirInfo["accessTime"] = timeText(fdInfoTime.AccessTime())
+	fileDirInfo["modTime"] = timeText(fdInfoTime.ModTime())
 
 	// Get type of the file/directory
-	fi, _ := os.Lstat(fileDir.FullPath)
-	fileDirInfo["type"] = "Unknown type"
+	fi, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	fileDirInfo["type"] = fileType(fi.Mode(), fileDir.IsMountPoint)
+	if fi.Mode()&os.ModeSymlink != 0 {
+		fileDirInfo["linkTarget"], fileDirInfo["targetSize"] = linkTargetInfo(fileDir, dirTree, fullPath)
+	}
+
+	// If it is a directory (or a followed link to a directory), count children and add content fields
+	if fi.Mode().IsDir() || fileDir.IsDir && fileDir.LinkTarget != "" {
+		fileDirInfo["content"] = "unreadable"
+		if file, err := os.Open(fullPath); err == nil {
+			defer file.Close()
+			childrenList, _ := file.Readdirnames(0)
+			fileDirInfo["content"] = elementsText(len(childrenList))
+		}
+		fileDirInfo["content"] += subtreeText(fileDir)
+	}
+
+	return fileDirInfo, nil
+}
+
+// Return the displayed target of a symbolic link (marked if it is dangling), and the displayed size of what it points to
+//	- fileDir: holds data of the symbolic link
+//	- dirTree: holds informations about scanned file/directory
+//	- fullPath: full path of the symbolic link
+func linkTargetInfo(fileDir *usData.Node, dirTree *usData.DirTree, fullPath string) (string, string) {
+	linkTarget, err := os.Readlink(fullPath)
+	if err != nil {
+		return "unreadable", "unknown"
+	}
+	targetInfo, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		return linkTarget + " (dangling: the target doesn't exist)", "none"
+	}
+	if err != nil {
+		return linkTarget + " (unreachable: " + errorReason(err) + ")", "unknown"
+	}
+	if !targetInfo.IsDir() {
+		return linkTarget, humanize.Bytes(uint64(targetInfo.Size()))
+	}
 
-	switch mode := fi.Mode(); {
+	// A directory: followed while scanning, or scanned through its own path if it is inside the scanned directory
+	if fileDir.LinkTarget != "" {
+		return linkTarget, humanize.Bytes(fileDir.Size) + " (followed)"
+	}
+	rootPath, rootErr := filepath.EvalSymlinks(dirTree.Root.Name)
+	targetPath, targetErr := filepath.EvalSymlinks(fullPath)
+	if rootErr == nil && targetErr == nil {
+		rootPath, _ = filepath.Abs(rootPath)
+		targetPath, _ = filepath.Abs(targetPath)
+		if relPath, err := filepath.Rel(rootPath, targetPath); err == nil {
+			if targetNode := dirTree.Lookup(filepath.Join(dirTree.Root.Name, relPath)); targetNode != nil {
+				return linkTarget, humanize.Bytes(dirTree.Stat(targetNode).Size) + " (counted at " + targetPath + ")"
+			}
+		}
+	}
+	return linkTarget, "unknown (directory not scanned)"
+}
+
+// Return the displayed type of a file/directory
+//	- mode: mode of the file/directory
+//	- isMountPoint: the directory is a mount point (not scanned)
+func fileType(mode os.FileMode, isMountPoint bool) string {
+	switch {
 	case mode.IsRegular():
-		fileDirInfo["type"] = "File"
+		return "File"
+	case mode.IsDir() && isMountPoint:
+		return "Mount point (not scanned)"
 	case mode.IsDir():
-		fileDirInfo["type"] = "Directory"
+		return "Directory"
 	case mode&os.ModeSymlink != 0:
-		fileDirInfo["type"] = "Symbolic link"
+		return "Symbolic link"
 	case mode&os.ModeNamedPipe != 0:
-		fileDirInfo["type"] = "Named pipe"
+		return "Named pipe"
 	}
+	return "Unknown type"
+}
 
-	//fileDirInfo["fullPath"] = fileDir.FullPath
-	fileDirInfo["name"] = path.Base(fileDir.FullPath)
-	fileDirInfo["size"] = humanize.Bytes(fileDir.Size)
-	fileDirInfo["parent"] = path.Dir(fileDir.FullPath)
-	fileDirInfo["accessTime"] = humanize.Time(fdInfoTime.AccessTime()) + " (" + accesTimeDatePart + " " + accesTimeGMTPart + ")"
-	fileDirInfo["modTime"] = humanize.Time(fdInfoTime.ModTime()) + " (" + modTimeDatePart + " " + modTimeGMTPart + ")"
-
-	// If it is a directory, count children and add content fields
-	if fileDirInfo["type"] == "Directory" {
-		file, _ := os.Open(fileDir.FullPath)
-		defer file.Close()
-		childrenList, _ := file.Readdirnames(0)
-
-		childrenDesc := " element"
-		if len(childrenList) >= 2 {
-			childrenDesc = childrenDesc + "s"
-		}
-		fileDirInfo["content"] = strconv.Itoa(len(childrenList)) + childrenDesc
+// Return the displayed time: relative time, then full date
+//	- fdTime: time to display
+func timeText(fdTime time.Time) string {
+	return humanize.Time(fdTime) + " (" + fdTime.Format("2006-01-02 15:04:05 -0700 MST") + ")"
+}
+
+// Return the displayed number of elements into a directory
+//	- count: number of elements
+func elementsText(count int) string {
+	childrenDesc := " element"
+	if count >= 2 {
+		childrenDesc = childrenDesc + "s"
 	}
+	return strconv.Itoa(count) + childrenDesc
+}
 
-	return fileDirInfo
+// Return the displayed number of files and directories into the whole subtree of a scanned directory (empty for others)
+//	- fileDir: holds data of the file/directory
+func subtreeText(fileDir *usData.Node) string {
+	if !fileDir.IsDir || fileDir.IsMountPoint || fileDir.IsExcluded || fileDir.IsDeferred {
+		return ""
+	}
+	countText := humanize.Comma(int64(fileDir.Files)) + " files, " + humanize.Comma(int64(fileDir.Dirs)) + " directories into the subtree"
+	if fileDir.HasDeferred {
+		countText = ">= " + countText
+	}
+	return " (" + countText + ")"
 }
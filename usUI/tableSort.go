@@ -0,0 +1,124 @@
+// Sort the contents table: by size, name, modification time, number of items or type, ascending or descending
+package usUI
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Column the contents table is sorted by
+type SortKey int
+
+// Available sort keys, in the order they are cycled through (see NextSortKey)
+const (
+	SortBySize    SortKey = iota // Size (size difference when comparing with a previous scan)
+	SortByName                   // Name, case insensitive
+	SortByModTime                // Last modification time
+	SortByItems                  // Number of files/directories into the subtree, then size
+	SortByType                   // Directories first, then files by extension
+)
+
+// Return the next sort key, and its natural order: largest/newest first for sizes, dates and counts, alphabetical for names and types
+//	- sortKey: current sort key
+func NextSortKey(sortKey SortKey) (SortKey, bool) {
+	next := (sortKey + 1) % (SortByType + 1)
+	return next, next == SortByName || next == SortByType
+}
+
+// Return the displayed name of a sort key
+//	- sortKey: sort key
+//	- comparing: comparing with a previous scan, sizes are sorted by growth
+func sortKeyText(sortKey SortKey, comparing bool) string {
+	switch sortKey {
+	case SortByName:
+		return "name"
+	case SortByModTime:
+		return "modification time"
+	case SortByItems:
+		return "items"
+	case SortByType:
+		return "type"
+	}
+	if comparing {
+		return "growth"
+	}
+	return "size"
+}
+
+// Return the displayed sort of the contents table: sort key and order
+//	- viewState: display settings of the main page
+func sortText(viewState *ViewState) string {
+	order := "▼"
+	if viewState.SortAscending {
+		order = "▲"
+	}
+	return "sorted by " + sortKeyText(viewState.SortKey, viewState.Baseline != nil) + " " + order
+}
+
+// Sort the rows of the contents table, rows sorted equal are sorted by name
+//	- entries: rows of the contents table
+//	- viewState: display settings of the main page
+func sortEntries(entries []tableEntry, viewState *ViewState) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		order := compareEntries(entries[i], entries[j], viewState)
+		if order == 0 {
+			return entries[i].info.Name < entries[j].info.Name
+		}
+		if viewState.SortAscending {
+			return order < 0
+		}
+		return order > 0
+	})
+}
+
+// Compare two rows of the contents table by the current sort key: negative if the first one is smaller, positive if it is larger
+//	- first: first row
+//	- second: second row
+//	- viewState: display settings of the main page
+func compareEntries(first, second tableEntry, viewState *ViewState) int {
+	switch viewState.SortKey {
+	case SortByName:
+		return strings.Compare(strings.ToLower(first.info.Name), strings.ToLower(second.info.Name))
+	case SortByModTime:
+		switch {
+		case first.info.ModTime.Before(second.info.ModTime):
+			return -1
+		case first.info.ModTime.After(second.info.ModTime):
+			return 1
+		}
+		return 0
+	case SortByItems:
+		if order := compareUint(first.info.Items, second.info.Items); order != 0 {
+			return order
+		}
+	case SortByType:
+		if first.info.IsDir != second.info.IsDir {
+			if first.info.IsDir {
+				return -1 // Directories first
+			}
+			return 1
+		}
+		return strings.Compare(strings.ToLower(filepath.Ext(first.info.Name)), strings.ToLower(filepath.Ext(second.info.Name)))
+	}
+
+	// Size, or growth since the previous scan
+	if viewState.Baseline != nil {
+		return compareUint(uint64(absDelta(first.delta)), uint64(absDelta(second.delta)))
+	}
+	return compareUint(first.info.DisplaySize(viewState.UseDiskSize), second.info.DisplaySize(viewState.UseDiskSize))
+}
+
+// Compare two counters: negative if the first one is smaller, positive if it is larger
+//	- first: first counter
+//	- second: second counter
+func compareUint(first, second uint64) int {
+	switch {
+	case first < second:
+		return -1
+	case first > second:
+		return 1
+	}
+	return 0
+}
+
@@ -0,0 +1,77 @@
+// Check the sort of the contents table: sort keys, orders, growth when comparing, and the cycle of sort keys
+package usUI
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	usData "UsedSpace/usData"
+)
+
+// Rows of the test contents table: directories and files of several sizes, dates and extensions
+func testEntries() []tableEntry {
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	return []tableEntry{
+		{info: usData.Node{Name: "b.txt", Size: 300, DiskSize: 4096, ModTime: day, Items: 1}, delta: -50},
+		{info: usData.Node{Name: "A.iso", Size: 100, DiskSize: 8192, ModTime: day.Add(time.Hour), Items: 1}, delta: 100},
+		{info: usData.Node{Name: "dir", IsDir: true, Size: 300, DiskSize: 12288, ModTime: day.Add(-time.Hour), Items: 20}, delta: 10},
+		{info: usData.Node{Name: "c.TXT", Size: 5, DiskSize: 4096, ModTime: day, Items: 1}, delta: -200},
+	}
+}
+
+// Return the names of sorted rows, for comparisons
+//	- entries: rows of the contents table
+func entryNames(entries []tableEntry) string {
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.info.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestSortEntries(t *testing.T) {
+	tests := []struct {
+		name      string
+		viewState ViewState
+		want      string
+	}{
+		{"size, equal sizes by name", ViewState{SortKey: SortBySize}, "b.txt dir A.iso c.TXT"},
+		{"size ascending", ViewState{SortKey: SortBySize, SortAscending: true}, "c.TXT A.iso b.txt dir"},
+		{"disk size", ViewState{SortKey: SortBySize, UseDiskSize: true}, "dir A.iso b.txt c.TXT"},
+		{"growth when comparing", ViewState{SortKey: SortBySize, Baseline: usData.NewDirTree("/r")}, "c.TXT A.iso b.txt dir"},
+		{"name, case insensitive", ViewState{SortKey: SortByName, SortAscending: true}, "A.iso b.txt c.TXT dir"},
+		{"modification time", ViewState{SortKey: SortByModTime}, "A.iso b.txt c.TXT dir"},
+		{"items, then size", ViewState{SortKey: SortByItems}, "dir b.txt A.iso c.TXT"},
+		{"type: directories first, then extension", ViewState{SortKey: SortByType, SortAscending: true}, "dir A.iso b.txt c.TXT"},
+	}
+	for _, test := range tests {
+		entries := testEntries()
+		sortEntries(entries, &test.viewState)
+		if got := entryNames(entries); got != test.want {
+			t.Errorf("%s: %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNextSortKey(t *testing.T) {
+	// Cycle through all sort keys from size, back to size
+	tests := []struct {
+		sortKey   SortKey
+		ascending bool
+	}{
+		{SortByName, true},
+		{SortByModTime, false},
+		{SortByItems, false},
+		{SortByType, true},
+		{SortBySize, false},
+	}
+	sortKey := SortBySize
+	for _, test := range tests {
+		var ascending bool
+		sortKey, ascending = NextSortKey(sortKey)
+		if sortKey != test.sortKey || ascending != test.ascending {
+			t.Errorf("next sort key %s (ascending %v), want %s (ascending %v)", sortKeyText(sortKey, false), ascending, sortKeyText(test.sortKey, false), test.ascending)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Exclude rules: files/directories matching them are not scanned (command line, exclude file, ignore files found into directories)
+package usWalk
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	usData "UsedSpace/usData"
+)
+
+// Name of the file holding exclude rules of its directory, applied into its whole subtree
+const IgnoreFileName = ".usedspaceignore"
+
+// Prefix of regular expressions into exclude files (other lines are glob patterns)
+const regexpPrefix = "re:"
+
+// Rule excluding files/directories from the scan
+type ExcludeRule struct {
+	Pattern  string // Glob pattern, or regular expression
+	IsRegexp bool
+	Base     string // Directory glob patterns holding a "/" are relative to (scanned directory, or directory holding the ignore file)
+	regexp   *regexp.Regexp
+}
+
+// Create an exclude rule, and return an error if the pattern is invalid
+// Glob patterns without "/" match base names ("*.iso", ".snapshot"), relative ones match paths under the base directory ("var/cache"),
+// absolute ones match full paths ("/mnt/backup/*"), a trailing "/" matches only directories. Regular expressions match full paths
+//	- pattern: glob pattern, or regular expression
+//	- isRegexp: the pattern is a regular expression
+//	- base: directory relative patterns are relative to
+func NewExcludeRule(pattern string, isRegexp bool, base string) (ExcludeRule, error) {
+	rule := ExcludeRule{Pattern: pattern, IsRegexp: isRegexp, Base: base}
+	if isRegexp {
+		var err error
+		rule.regexp, err = regexp.Compile(pattern)
+		return rule, err
+	}
+
+	if _, err := filepath.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil || pattern == "" {
+		return rule, fmt.Errorf("invalid exclude pattern %q", pattern)
+	}
+	return rule, nil
+}
+
+// Read exclude rules from a file: one rule per line, regular expressions are prefixed by "re:", empty lines and lines starting with "#" are skipped
+//	- fileName: path of the exclude file
+//	- base: directory relative patterns are relative to
+func ReadExcludeFile(fileName string, base string) ([]ExcludeRule, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []ExcludeRule{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := NewExcludeRule(strings.TrimPrefix(line, regexpPrefix), strings.HasPrefix(line, regexpPrefix), base)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fileName, lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// Return the path of the user's exclude file, whose rules apply to every scan (see ReadUserExcludes)
+func userExcludeFile() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "UsedSpace", "excludes"), nil
+}
+
+// Read the rules of the user's exclude file (same format as ReadExcludeFile), none if there is no such file
+//	- base: directory relative patterns are relative to
+func ReadUserExcludes(base string) ([]ExcludeRule, error) {
+	fileName, err := userExcludeFile()
+	if err != nil {
+		return nil, nil // No configuration directory: no exclude file either
+	}
+	rules, err := ReadExcludeFile(fileName, base)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return rules, err
+}
+
+// Return the rule as written into an exclude file
+func (rule ExcludeRule) String() string {
+	if rule.IsRegexp {
+		return regexpPrefix + rule.Pattern
+	}
+	return rule.Pattern
+}
+
+// Return true if the file/directory matches the rule
+//	- fullPath: full path of the file/directory
+//	- isDir: the file/directory is a directory
+func (rule ExcludeRule) Match(fullPath string, isDir bool) bool {
+	if rule.IsRegexp {
+		return rule.regexp.MatchString(fullPath)
+	}
+
+	pattern := rule.Pattern
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	matchedPath := filepath.Base(fullPath)
+	switch {
+	case filepath.IsAbs(pattern):
+		matchedPath = fullPath
+	case strings.Contains(pattern, "/"):
+		relPath, err := filepath.Rel(rule.Base, fullPath)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, "../") {
+			return false
+		}
+		matchedPath = relPath
+	}
+	matched, _ := filepath.Match(pattern, matchedPath)
+	return matched
+}
+
+// Return true if the file/directory matches one of the rules
+//	- excludes: exclude rules
+//	- fullPath: full path of the file/directory
+//	- isDir: the file/directory is a directory
+func isExcluded(excludes []ExcludeRule, fullPath string, isDir bool) bool {
+	for _, rule := range excludes {
+		if rule.Match(fullPath, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return exclude rules applied into a directory's content: scan options' ones, with those of ignore files of the directory and its parents
+// Unreadable ignore files are skipped (their error was recorded when their directory was read)
+//	- dirTree: holds informations about file/directory
+//	- dirNode: directory's node, nil for rules applied to the scanned directory itself
+//	- scanOptions: options used while scanning
+func dirExcludes(dirTree *usData.DirTree, dirNode *usData.Node, scanOptions ScanOptions) []ExcludeRule {
+	return inheritedExcludes(dirTree, dirNode, scanOptions, func(ancestor *usData.Node) []ExcludeRule {
+		return ignoreFileRules(dirTree, ancestor)
+	})
+}
+
+// Return exclude rules applied into a directory's content, rules of each ignore file being given by a function (see Watcher.ignoreFileRules)
+//	- dirTree: holds informations about file/directory
+//	- dirNode: directory's node, nil for rules applied to the scanned directory itself
+//	- scanOptions: options used while scanning
+//	- ignoreRules: return the rules of the ignore file of a directory, nil if it has none
+func inheritedExcludes(dirTree *usData.DirTree, dirNode *usData.Node, scanOptions ScanOptions, ignoreRules func(dirNode *usData.Node) []ExcludeRule) []ExcludeRule {
+	dirs := []*usData.Node{}
+	for current := dirNode; current != nil; current = dirTree.Stat(current).Parent {
+		dirs = append(dirs, current)
+	}
+
+	excludes := scanOptions.Excludes
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if rules := ignoreRules(dirs[i]); len(rules) > 0 {
+			excludes = append(append([]ExcludeRule{}, excludes...), rules...)
+		}
+	}
+	return excludes
+}
+
+// Return the rules of the ignore file of a directory, nil if it has none or if it is unreadable
+//	- dirTree: holds informations about file/directory
+//	- dirNode: directory's node
+func ignoreFileRules(dirTree *usData.DirTree, dirNode *usData.Node) []ExcludeRule {
+	if dirTree.Child(dirNode, IgnoreFileName) == nil {
+		return nil
+	}
+	dirPath := dirTree.FullPath(dirNode)
+	rules, err := ReadExcludeFile(filepath.Join(dirPath, IgnoreFileName), dirPath)
+	if err != nil {
+		return nil
+	}
+	return rules
+}
+
+// Add an excluded file/directory into its parent directory as an empty entry (nothing is added if excluded entries are hidden)
+//	- dirTree: holds informations about file/directory
+//	- dirNode: parent directory's node
+//	- info: copy of the excluded file/directory's node (name, type, mode and modification time are kept)
+//	- scanOptions: options used while scanning
+func addExcluded(dirTree *usData.DirTree, dirNode *usData.Node, info usData.Node, scanOptions ScanOptions) {
+	if scanOptions.HideExcluded {
+		return
+	}
+
+	node := &usData.Node{Name: info.Name, IsDir: info.IsDir, IsExcluded: true, Mode: info.Mode, ModTime: info.ModTime, Links: uint64(1)}
+	dirTree.AddChild(dirNode, node)
+	if node.IsDir {
+		dirTree.DirDone(node)
+	}
+}
@@ -0,0 +1,195 @@
+// Check exclude rules: glob patterns, regular expressions, exclude files and ignore files found into directories
+package usWalk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	usData "UsedSpace/usData"
+)
+
+func TestExcludeRuleMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		isRegexp bool
+		fullPath string
+		isDir    bool
+		want     bool
+	}{
+		// Base names
+		{"*.iso", false, "/srv/images/debian.iso", false, true},
+		{"*.iso", false, "/srv/images/debian.img", false, false},
+		{".snapshot", false, "/srv/a/.snapshot", true, true},
+		// Trailing "/": directories only
+		{"backup/", false, "/srv/a/backup", true, true},
+		{"backup/", false, "/srv/a/backup", false, false},
+		// Relative to the base directory
+		{"var/cache", false, "/srv/var/cache", true, true},
+		{"var/cache", false, "/srv/other/var/cache", true, false},
+		{"var/cache", false, "/elsewhere/var/cache", true, false},
+		{"a/*/tmp", false, "/srv/a/b/tmp", true, true},
+		// Absolute
+		{"/mnt/backup/*", false, "/mnt/backup/daily", true, true},
+		{"/mnt/backup/*", false, "/mnt/backup/daily/file", false, false},
+		// Regular expressions match full paths
+		{`\.(iso|img)$`, true, "/srv/images/debian.img", false, true},
+		{`^/srv/[^/]+$`, true, "/srv/images/debian.img", false, false},
+	}
+	for _, test := range tests {
+		rule, err := NewExcludeRule(test.pattern, test.isRegexp, "/srv")
+		if err != nil {
+			t.Fatalf("NewExcludeRule(%q): %v", test.pattern, err)
+		}
+		if got := rule.Match(test.fullPath, test.isDir); got != test.want {
+			t.Errorf("%q.Match(%q, %v) = %v, want %v", test.pattern, test.fullPath, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestNewExcludeRuleErrors(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		isRegexp bool
+	}{
+		{"", false},
+		{"[a-", false},
+		{"(unclosed", true},
+	}
+	for _, test := range tests {
+		if _, err := NewExcludeRule(test.pattern, test.isRegexp, "/srv"); err == nil {
+			t.Errorf("NewExcludeRule(%q, %v) should fail", test.pattern, test.isRegexp)
+		}
+	}
+}
+
+func TestReadExcludeFile(t *testing.T) {
+	tempDir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    []string // Rules read, as written into an exclude file
+		wantErr string
+	}{
+		{"rules", "# comment\n\n*.iso\n  var/cache  \nre:\\.img$\n", []string{"*.iso", "var/cache", `re:\.img$`}, ""},
+		{"empty", "\n# only comments\n", []string{}, ""},
+		{"invalid glob", "*.iso\n[a-\n", nil, ":2: invalid exclude pattern"},
+		{"invalid regexp", "re:(unclosed\n", nil, ":1: "},
+	}
+	for _, test := range tests {
+		fileName := filepath.Join(tempDir, test.name)
+		if err := os.WriteFile(fileName, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		rules, err := ReadExcludeFile(fileName, tempDir)
+		if test.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), fileName+test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, fileName+test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := []string{}
+		for _, rule := range rules {
+			got = append(got, rule.String())
+			if rule.Base != tempDir {
+				t.Errorf("%s: rule %s is relative to %s, want %s", test.name, rule, rule.Base, tempDir)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s: rules %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	if _, err := ReadExcludeFile(filepath.Join(tempDir, "missing"), tempDir); err == nil {
+		t.Errorf("reading a missing exclude file should fail")
+	}
+}
+
+func TestDirExcludes(t *testing.T) {
+	// root/.usedspaceignore excludes "*.log", root/sub/.usedspaceignore excludes "cache/" into the subtree of sub
+	rootPath := t.TempDir()
+	subPath := filepath.Join(rootPath, "sub")
+	if err := os.Mkdir(subPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootPath, IgnoreFileName), []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(subPath, IgnoreFileName), []byte("cache/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dirTree := usData.NewDirTree(rootPath)
+	dirTree.AddChild(dirTree.Root, &usData.Node{Name: IgnoreFileName, Links: 1})
+	subNode := dirTree.AddChild(dirTree.Root, &usData.Node{Name: "sub", IsDir: true})
+	dirTree.AddChild(subNode, &usData.Node{Name: IgnoreFileName, Links: 1})
+	otherNode := dirTree.AddChild(dirTree.Root, &usData.Node{Name: "other", IsDir: true})
+
+	commandLine, _ := NewExcludeRule("*.iso", false, rootPath)
+	scanOptions := ScanOptions{Excludes: []ExcludeRule{commandLine}}
+
+	tests := []struct {
+		name     string
+		dirNode  *usData.Node
+		fullPath string
+		isDir    bool
+		want     bool
+	}{
+		{"command line rule", otherNode, filepath.Join(rootPath, "other", "a.iso"), false, true},
+		{"root ignore file into a subdirectory", otherNode, filepath.Join(rootPath, "other", "a.log"), false, true},
+		{"ignore file of the directory", subNode, filepath.Join(subPath, "cache"), true, true},
+		{"ignore file of another directory", otherNode, filepath.Join(rootPath, "other", "cache"), true, false},
+		{"not excluded", subNode, filepath.Join(subPath, "a.txt"), false, false},
+	}
+	for _, test := range tests {
+		excludes := dirExcludes(dirTree, test.dirNode, scanOptions)
+		if got := isExcluded(excludes, test.fullPath, test.isDir); got != test.want {
+			t.Errorf("%s: %s excluded %v, want %v (rules %v)", test.name, test.fullPath, got, test.want, excludes)
+		}
+	}
+
+	if excludes := dirExcludes(dirTree, nil, scanOptions); len(excludes) != 1 {
+		t.Errorf("rules applied to the scanned directory itself: %v, want only the command line ones", excludes)
+	}
+}
+
+func TestReadUserExcludes(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir) // Used by os.UserConfigDir on Unix systems (except macOS)
+	fileName, err := userExcludeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileName != filepath.Join(configDir, "UsedSpace", "excludes") {
+		t.Skipf("user's exclude file %s is not into $XDG_CONFIG_HOME on this system", fileName)
+	}
+
+	// No exclude file: no rules, no error
+	if rules, err := ReadUserExcludes("/srv"); rules != nil || err != nil {
+		t.Errorf("without exclude file: rules %v, error %v, want none", rules, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, []byte("*.iso\nvar/cache\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := ReadUserExcludes("/srv")
+	if err != nil || len(rules) != 2 || rules[1].Base != "/srv" {
+		t.Errorf("rules %v, error %v, want *.iso and var/cache relative to /srv", rules, err)
+	}
+
+	if err := os.WriteFile(fileName, []byte("[a-\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadUserExcludes("/srv"); err == nil || !strings.HasPrefix(err.Error(), fileName+":1: ") {
+		t.Errorf("invalid exclude file: error %v, want it reported with its line", err)
+	}
+}
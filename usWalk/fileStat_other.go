@@ -0,0 +1,27 @@
+//go:build !unix
+// +build !unix
+
+// Low level informations about files and directories are not available on this system
+package usWalk
+
+import (
+	"os"
+)
+
+// Return false: the device holding the file/directory is not available on this system
+//	- info: file/directory's informations returned by Lstat
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return uint64(0), false
+}
+
+// Return false: inode numbers and hard links are not available on this system
+//	- info: file/directory's informations returned by Lstat
+func inodeInfo(info os.FileInfo) (uint64, uint64, uint64, bool) {
+	return uint64(0), uint64(0), uint64(0), false
+}
+
+// Return false: the space allocated on disk is not available on this system (apparent sizes are used)
+//	- info: file/directory's informations returned by Lstat
+func diskSize(info os.FileInfo) (uint64, bool) {
+	return uint64(0), false
+}
@@ -0,0 +1,44 @@
+//go:build unix
+// +build unix
+
+// Read low level informations about files and directories (device, ...)
+package usWalk
+
+import (
+	"os"
+	"syscall"
+)
+
+// Return the ID of the device holding the file/directory, and false if it is not available
+//	- info: file/directory's informations returned by Lstat
+func deviceID(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return uint64(0), false
+	}
+
+	return uint64(stat.Dev), true
+}
+
+// Return the device ID, the inode number and the number of hard links of the file/directory, and false if they are not available
+//	- info: file/directory's informations returned by Lstat
+func inodeInfo(info os.FileInfo) (uint64, uint64, uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return uint64(0), uint64(0), uint64(0), false
+	}
+
+	return uint64(stat.Dev), uint64(stat.Ino), uint64(stat.Nlink), true
+}
+
+// Return the space really allocated on disk for the file/directory (from st_blocks), and false if it is not available
+//	- info: file/directory's informations returned by Lstat
+func diskSize(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return uint64(0), false
+	}
+
+	// st_blocks is always counted in 512 bytes units
+	return uint64(stat.Blocks) * 512, true
+}
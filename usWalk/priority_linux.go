@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+// Lower priorities of the process on Linux: idle I/O class and lowest CPU priority
+package usWalk
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// I/O priority of the idle class (see ioprio_set(2)): the disk is used only when no other process needs it
+const (
+	ioprioWhoProcess = 1
+	ioprioIdle       = 3 << 13
+)
+
+// Lower CPU and I/O priorities of the process, so the scan doesn't slow down other processes
+// Priorities are set per thread on Linux: they are set for all current threads, new threads inherit them
+func LowerPriority() error {
+	taskDir, err := os.Open("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	tasks, err := taskDir.Readdirnames(0)
+	taskDir.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task)
+		if err != nil {
+			continue
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioIdle); errno != 0 && errno != syscall.ESRCH {
+			return errno
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, 19); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+// +build !unix
+
+// Priorities of the process can't be lowered on other systems
+package usWalk
+
+import (
+	"errors"
+)
+
+// Return an error: lowering priorities is not available on this system
+func LowerPriority() error {
+	return errors.New("lowering priorities is not available on this system")
+}
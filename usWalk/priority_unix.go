@@ -0,0 +1,14 @@
+//go:build unix && !linux
+// +build unix,!linux
+
+// Lower priorities of the process on other unix systems: only the CPU priority can be lowered
+package usWalk
+
+import (
+	"syscall"
+)
+
+// Lower the CPU priority of the process, so the scan doesn't slow down other processes (I/O priority is not available on this system)
+func LowerPriority() error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, 19)
+}
@@ -0,0 +1,56 @@
+// Throttle a scan: limit the number of entries read per second, so a busy server (database host, shared NFS) keeps its latency
+package usWalk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limit the number of entries read per second, shared by all directory readers of a scan
+type rateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration // Time given to each entry
+	next     time.Time     // End of the time given to entries already read
+}
+
+// Create a limiter, or return nil if the rate is not limited
+//	- rate: maximum number of entries read per second (0 for no limit)
+func newRateLimiter(rate int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Second / time.Duration(rate)}
+}
+
+// Wait for the time given to the number of entries read (or about to be read), and return false if the scan was cancelled meanwhile
+// Time not used while nothing was read is not saved for later: entries are never read in bursts
+//	- ctx: context to cancel the scan
+//	- entries: number of entries to read (directories to open, files to stat)
+func (limiter *rateLimiter) wait(ctx context.Context, entries int) bool {
+	if limiter == nil {
+		return true
+	}
+
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	limiter.next = limiter.next.Add(time.Duration(entries) * limiter.interval)
+	end := limiter.next
+	limiter.mutex.Unlock()
+
+	delay := time.Until(end)
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,54 @@
+// Check the throttle of scans: entries read per second, no bursts after idle time, cancelled waits
+package usWalk
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0) != nil {
+		t.Errorf("a scan without limit should have no limiter")
+	}
+	var unlimited *rateLimiter
+	if !unlimited.wait(context.Background(), 1000) {
+		t.Errorf("waiting without limit should not fail")
+	}
+
+	// 100 entries per second: 20 entries take 200ms, read one by one or at once
+	limiter := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		limiter.wait(context.Background(), 1)
+	}
+	limiter.wait(context.Background(), 10)
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("20 entries read in %v, want about 200ms", elapsed)
+	}
+
+	// Time not used is not saved for later
+	time.Sleep(100 * time.Millisecond)
+	start = time.Now()
+	limiter.wait(context.Background(), 5)
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 entries read in %v after idle time, want about 50ms", elapsed)
+	}
+}
+
+func TestRateLimiterCancelled(t *testing.T) {
+	limiter := newRateLimiter(1) // One entry per second
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	if limiter.wait(ctx, 10) {
+		t.Errorf("a wait cancelled meanwhile should fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("a cancelled wait returned after %v, want right after the cancel", elapsed)
+	}
+}
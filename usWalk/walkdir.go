@@ -2,49 +2,557 @@
 package usWalk
 
 import (
+	"context"
+	"fmt"
 	"os"
-	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/MichaelTJones/walk"
-	"github.com/orcaman/concurrent-map"
-
-	usUI "UsedSpace/usUI"
+	usData "UsedSpace/usData"
 )
 
+// Options used while scanning a directory
+type ScanOptions struct {
+	OneFileSystem bool // Don't descend into directories from other filesystems (mount points)
+
+	// Previous scan of the same directory: content of directories not modified since (same mtime) is reused instead of read again
+	// Files modified in place don't change their directory's mtime, their size stays the cached one (nil to read everything)
+	Cache *usData.DirTree
+
+	// Files/directories not scanned, ignore files found into directories (see IgnoreFileName) add their own rules for their subtree
+	Excludes     []ExcludeRule
+	HideExcluded bool // Don't add excluded files/directories into the tree, instead of adding them as empty entries
+
+	// Number of directory levels read under the scanned directory (0 for all), deeper directories are read when they are expanded
+	MaxDepth int
+
+	// Follow symbolic links whose target is outside the scanned directory (the others are counted through their target's path)
+	// Each target is counted only once, links reaching an already counted file/directory (loops included) are kept as links
+	FollowSymlinks bool
+
+	// Load put on the filesystem (they don't change scan results)
+	Jobs int // Number of directories read in parallel (0 for 4 per CPU)
+	Rate int // Maximum number of entries read per second, by all readers (0 for no limit)
+}
+
+// Return a key identifying options which change scan results (a cached scan is only reused with the same options)
+func (scanOptions ScanOptions) Key() string {
+	key := "x=" + strconv.FormatBool(scanOptions.OneFileSystem) + ";hide=" + strconv.FormatBool(scanOptions.HideExcluded) +
+		";depth=" + strconv.Itoa(scanOptions.MaxDepth) + ";L=" + strconv.FormatBool(scanOptions.FollowSymlinks)
+	for _, rule := range scanOptions.Excludes {
+		key += ";exclude=" + rule.String()
+	}
+	return key
+}
+
+// Return true if directories of the given level are beyond the maximum depth (they are not read)
+//	- level: level under the directory the scan started from
+func (scanOptions ScanOptions) beyondMaxDepth(level int) bool {
+	return scanOptions.MaxDepth > 0 && level > scanOptions.MaxDepth
+}
+
+// Counters describing a running scan
+type ScanCounters struct {
+	Files       uint64 // Number of files found
+	Dirs        uint64 // Number of directories found
+	Bytes       uint64 // Apparent size of files found (each hard linked file only once)
+	Errors      uint64 // Number of files/directories which couldn't be read
+	CurrentPath string // Directory being read
+	StartTime   time.Time
+	EndTime     time.Time // Zero while the scan is running
+	Cancelled   bool      // Scan was stopped before all directories were read
+}
+
+// Holds progress of a scan, safe to read while the scan is running
+type ScanProgress struct {
+	mutex    sync.Mutex
+	counters ScanCounters
+}
+
+// Return a copy of the scan counters
+func (scanProgress *ScanProgress) Counters() ScanCounters {
+	scanProgress.mutex.Lock()
+	defer scanProgress.mutex.Unlock()
+
+	return scanProgress.counters
+}
+
+// Return the number of files and directories read per second
+func (counters ScanCounters) EntriesPerSecond() float64 {
+	elapsed := counters.Elapsed().Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(counters.Files+counters.Dirs) / elapsed
+}
+
+// Return the time spent scanning
+func (counters ScanCounters) Elapsed() time.Duration {
+	if counters.EndTime.IsZero() {
+		return time.Since(counters.StartTime)
+	}
+	return counters.EndTime.Sub(counters.StartTime)
+}
+
+// Update scan counters
+//	- update: function modifying the counters
+func (scanProgress *ScanProgress) update(update func(counters *ScanCounters)) {
+	scanProgress.mutex.Lock()
+	defer scanProgress.mutex.Unlock()
+
+	update(&scanProgress.counters)
+}
+
+// Directory waiting to be read
+type dirJob struct {
+	dirNode  *usData.Node
+	fullPath string
+
+	cached    *usData.Node // Same directory into the previous scan (see ScanOptions.Cache), nil if not found
+	unchanged bool         // Not modified since the previous scan: its cached content is reused
+
+	excludes []ExcludeRule // Rules applied into the directory's content: scan options' ones, with those of ignore files of its parents
+	depth    int           // Level under the directory the scan started from (see ScanOptions.MaxDepth)
+	followed bool          // Reached through a followed symbolic link: its content is counted only once (see ScanOptions.FollowSymlinks)
+}
+
+// Holds the state of a running scan
+type scanner struct {
+	ctx         context.Context
+	dirTree     *usData.DirTree
+	scanOptions ScanOptions
+	rootDevice  uint64 // Device of the scanned directory, used to detect mount points
+	progress    *ScanProgress
+	limiter     *rateLimiter // Nil if the rate is not limited
+	rootPath    string       // Absolute path of the scanned directory, symbolic links resolved
+
+	// Directories waiting to be read, shared by all readers
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	jobs   []dirJob
+	active int // Number of directories being read
+}
+
 // Scan the given path and holds files and directories informations
+// Sizes of directories are updated while the scan is running, each directory is marked done when its whole subtree was read
+//	- ctx: context to cancel the scan, directories not read yet stay incomplete into the tree
 //	- givenPath: directory's path to scan
-//	- cDirFilesMap: will holds informations about file/directory
+//	- dirTree: will holds informations about file/directory
+//	- scanOptions: options used while scanning
+//	- scanProgress: will holds counters updated while scanning
 //	- scanState: channel to check the scan status
-func WalkGivenDir(givenPath string, cDirFilesMap cmap.ConcurrentMap, scanState chan bool) {
-	walk.Walk(givenPath, func(root string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+func WalkGivenDir(ctx context.Context, givenPath string, dirTree *usData.DirTree, scanOptions ScanOptions, scanProgress *ScanProgress, scanState chan bool) {
+	scanProgress.update(func(counters *ScanCounters) { counters.Dirs++ }) // The scanned directory itself
+	rootJob := dirJob{dirNode: dirTree.Root, fullPath: givenPath, excludes: scanOptions.Excludes}
+	if rootInfo, err := os.Lstat(givenPath); err == nil {
+		dirTree.Root.Mode, dirTree.Root.ModTime = rootInfo.Mode(), rootInfo.ModTime()
+		dirTree.Root.DiskSize, _ = diskSize(rootInfo)
+
+		// Start from the cached scanned directory, if the cache holds the same directory
+		if scanOptions.Cache != nil && scanOptions.Cache.Root.Name == givenPath {
+			rootJob.cached = scanOptions.Cache.Root
+			rootJob.unchanged = isUnchanged(rootInfo, scanOptions.Cache.Stat(rootJob.cached))
 		}
-		if cDirFilesMap.Set(root, usUI.FileDirStruct{root, uint64(info.Size()), false}); info.IsDir() {
-			cDirFilesMap.Set(root, usUI.FileDirStruct{root, uint64(0), true})
+	}
+
+	scanDirs(ctx, []dirJob{rootJob}, dirTree, scanOptions, scanProgress)
+
+	// Signal that the scan is done
+	scanState <- true
+}
+
+// Resume a cancelled scan: read all directories not read yet
+//	- ctx: context to cancel the scan again
+//	- dirTree: holds informations about file/directory found by the cancelled scan
+//	- scanOptions: options used while scanning
+//	- scanProgress: will holds counters updated while scanning
+//	- scanState: channel to check the scan status
+func ResumeScan(ctx context.Context, dirTree *usData.DirTree, scanOptions ScanOptions, scanProgress *ScanProgress, scanState chan bool) {
+	jobs := []dirJob{}
+	for _, dirNode := range dirTree.UnreadDirs() {
+		jobs = append(jobs, dirJob{dirNode: dirNode, fullPath: dirTree.FullPath(dirNode), excludes: dirExcludes(dirTree, dirTree.Stat(dirNode).Parent, scanOptions), depth: dirTree.Depth(dirNode)})
+	}
+
+	scanDirs(ctx, jobs, dirTree, scanOptions, scanProgress)
+
+	// Signal that the scan is done
+	scanState <- true
+}
+
+// Read again a directory already scanned: its previous content is replaced, and the size difference is applied to all its parents
+// A directory beyond the maximum depth is read the same way, the maximum depth applies under it
+//	- ctx: context to cancel the scan, directories not read yet stay incomplete into the tree
+//	- dirTree: holds informations about file/directory
+//	- dirNode: node of the directory to read again
+//	- scanOptions: options used while scanning (the cache is never used: the directory is really read)
+//	- scanProgress: will holds counters updated while scanning
+//	- scanState: channel to check the scan status
+func RescanDir(ctx context.Context, dirTree *usData.DirTree, dirNode *usData.Node, scanOptions ScanOptions, scanProgress *ScanProgress, scanState chan bool) {
+	scanProgress.update(func(counters *ScanCounters) { counters.Dirs++ }) // The directory read again itself
+	scanOptions.Cache = nil
+	dirTree.ResetDir(dirNode)
+
+	job := dirJob{dirNode: dirNode, fullPath: dirTree.FullPath(dirNode), excludes: dirExcludes(dirTree, dirTree.Stat(dirNode).Parent, scanOptions)}
+	scanDirs(ctx, []dirJob{job}, dirTree, scanOptions, scanProgress)
+
+	// Signal that the scan is done
+	scanState <- true
+}
+
+// Read the given directories and all their subdirectories in parallel
+//	- ctx: context to cancel the scan
+//	- jobs: directories to read
+//	- dirTree: will holds informations about file/directory
+//	- scanOptions: options used while scanning
+//	- scanProgress: will holds counters updated while scanning
+func scanDirs(ctx context.Context, jobs []dirJob, dirTree *usData.DirTree, scanOptions ScanOptions, scanProgress *ScanProgress) {
+	dirScanner := &scanner{ctx: ctx, dirTree: dirTree, scanOptions: scanOptions, progress: scanProgress, limiter: newRateLimiter(scanOptions.Rate), jobs: jobs}
+	dirScanner.cond = sync.NewCond(&dirScanner.mutex)
+	if rootPath, err := filepath.EvalSymlinks(dirTree.Root.Name); err == nil {
+		dirScanner.rootPath, _ = filepath.Abs(rootPath)
+	}
+	scanProgress.update(func(counters *ScanCounters) { counters.StartTime = time.Now() })
+
+	if rootInfo, err := os.Lstat(dirTree.Root.Name); err == nil {
+		dirScanner.rootDevice, _ = deviceID(rootInfo)
+	}
+
+	// Wake up waiting readers when the scan is cancelled
+	stopWatching := make(chan bool)
+	defer close(stopWatching)
+	go func() {
+		select {
+		case <-ctx.Done():
+			dirScanner.cond.Broadcast()
+		case <-stopWatching:
 		}
-		return nil
+	}()
+
+	// Read directories in parallel
+	readers := scanOptions.Jobs
+	if readers <= 0 {
+		readers = 4 * runtime.NumCPU()
+	}
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(readers)
+	for i := 0; i < readers; i++ {
+		go func() {
+			defer waitGroup.Done()
+			dirScanner.readDirs()
+		}()
+	}
+	waitGroup.Wait()
+
+	scanProgress.update(func(counters *ScanCounters) {
+		counters.EndTime = time.Now()
+		counters.CurrentPath = ""
+		counters.Cancelled = ctx.Err() != nil
 	})
+}
 
-	// Update all directories Size
-	for _, k := range cDirFilesMap.Keys() {
-		v, _ := cDirFilesMap.Get(k)
-		currentParent := k
+// Read waiting directories until all directories were read
+func (dirScanner *scanner) readDirs() {
+	for {
+		dirScanner.mutex.Lock()
+		for len(dirScanner.jobs) == 0 && dirScanner.active > 0 && dirScanner.ctx.Err() == nil {
+			dirScanner.cond.Wait()
+		}
 
-		// Update all parents until the given path was reached
-		for currentParent != givenPath {
-			currentParent = path.Dir(currentParent)
+		// Nothing to read and nobody reading: the scan is done (or cancelled, waiting directories stay unread)
+		if len(dirScanner.jobs) == 0 || dirScanner.ctx.Err() != nil {
+			dirScanner.mutex.Unlock()
+			dirScanner.cond.Broadcast()
+			return
+		}
+
+		// Take the latest directory found (depth first, to keep the waiting list short)
+		job := dirScanner.jobs[len(dirScanner.jobs)-1]
+		dirScanner.jobs = dirScanner.jobs[:len(dirScanner.jobs)-1]
+		dirScanner.active++
+		dirScanner.mutex.Unlock()
 
-			// Update all parents directories only by using files
-			if !v.(usUI.FileDirStruct).IsDir {
-				currentParentObj, _ := cDirFilesMap.Get(currentParent)
-				currentParentSize := currentParentObj.(usUI.FileDirStruct).Size
+		// A throttled scan waits for its turn, the directory stays unread if the scan is cancelled meanwhile
+		if dirScanner.limiter.wait(dirScanner.ctx, 1) {
+			dirScanner.readDir(job)
+		}
 
-				cDirFilesMap.Set(currentParent, usUI.FileDirStruct{currentParent, uint64(v.(usUI.FileDirStruct).Size + currentParentSize), true})
+		dirScanner.mutex.Lock()
+		dirScanner.active--
+		dirScanner.mutex.Unlock()
+		dirScanner.cond.Broadcast()
+	}
+}
+
+// Read a directory: add its children into the tree, and its subdirectories to the waiting list
+// A directory not modified since the previous scan is not read: its cached files are reused, only its subdirectories are checked
+//	- job: directory to read
+func (dirScanner *scanner) readDir(job dirJob) {
+	defer dirScanner.dirTree.DirDone(job.dirNode)
+	dirScanner.progress.update(func(counters *ScanCounters) { counters.CurrentPath = job.fullPath })
+	cache := dirScanner.scanOptions.Cache
+
+	// Counters of this directory, added to scan counters once it was read
+	readCounters := ScanCounters{}
+	defer dirScanner.progress.update(func(counters *ScanCounters) {
+		counters.Files += readCounters.Files
+		counters.Dirs += readCounters.Dirs
+		counters.Bytes += readCounters.Bytes
+		counters.Errors += readCounters.Errors
+	})
+
+	subDirs := []dirJob{}
+	if job.unchanged {
+		if cache.Child(job.cached, IgnoreFileName) != nil {
+			job.excludes = dirScanner.readIgnoreFile(job, &readCounters)
+		}
+		for _, cachedChild := range cache.Children(job.cached) {
+			cachedInfo := cache.Stat(cachedChild)
+			if isExcluded(job.excludes, filepath.Join(job.fullPath, cachedInfo.Name), cachedInfo.IsDir) {
+				addExcluded(dirScanner.dirTree, job.dirNode, cachedInfo, dirScanner.scanOptions)
+				continue
+			}
+			if !cachedInfo.IsDir && cachedInfo.LinkTarget == "" {
+				dirScanner.addFile(job, cachedFileNode(cachedInfo), &readCounters)
+				continue
+			}
+
+			// Subdirectories and targets of followed symbolic links may have been modified, even if their parent directory wasn't
+			dirScanner.limiter.wait(dirScanner.ctx, 1)
+			info, err := os.Lstat(filepath.Join(job.fullPath, cachedInfo.Name))
+			if err != nil {
+				continue // Removed since the directory was checked
+			}
+			if info.Mode()&os.ModeSymlink != 0 && dirScanner.scanOptions.FollowSymlinks {
+				subDirs = dirScanner.addLink(job, info, subDirs, &readCounters) // Its target is read again, and counted only once
+				continue
+			}
+			if !info.IsDir() {
+				dirScanner.addFile(job, fileNode(info), &readCounters)
+				continue
+			}
+			subDirs = dirScanner.addDir(job, info, cachedChild, "", subDirs, &readCounters)
+		}
+	} else {
+
+		// Skip unreadable directories instead of aborting the whole scan (common when scanning "/")
+		// Errors are recorded into the tree, directories having errors inside are marked
+		dir, err := os.Open(job.fullPath)
+		if err != nil {
+			dirScanner.dirTree.AddError(job.dirNode, err)
+			readCounters.Errors++
+			return
+		}
+		childrenInfo, err := dir.Readdir(0)
+		dir.Close()
+		if err != nil {
+			dirScanner.dirTree.AddError(job.dirNode, err)
+			readCounters.Errors++
+		}
+		dirScanner.limiter.wait(dirScanner.ctx, len(childrenInfo)) // Each entry was read with its own stat call
+
+		// Subdirectories of the previous scan, reused if they were not modified since
+		cachedChildren := make(map[string]*usData.Node)
+		if job.cached != nil {
+			for _, cachedChild := range cache.Children(job.cached) {
+				cachedChildren[cachedChild.Name] = cachedChild
+			}
+		}
+
+		for _, info := range childrenInfo {
+			if info.Name() == IgnoreFileName {
+				job.excludes = dirScanner.readIgnoreFile(job, &readCounters)
+			}
+		}
+
+		for _, info := range childrenInfo {
+			if isExcluded(job.excludes, filepath.Join(job.fullPath, info.Name()), info.IsDir()) {
+				addExcluded(dirScanner.dirTree, job.dirNode, usData.Node{Name: info.Name(), IsDir: info.IsDir(), Mode: info.Mode(), ModTime: info.ModTime()}, dirScanner.scanOptions)
+				continue
+			}
+			if info.IsDir() {
+				subDirs = dirScanner.addDir(job, info, cachedChildren[info.Name()], "", subDirs, &readCounters)
+			} else if info.Mode()&os.ModeSymlink != 0 && dirScanner.scanOptions.FollowSymlinks {
+				subDirs = dirScanner.addLink(job, info, subDirs, &readCounters)
+			} else {
+				dirScanner.addFile(job, fileNode(info), &readCounters)
 			}
 		}
 	}
 
-	// Signal that the scan is done
-	scanState <- true
+	// Add subdirectories to the waiting list
+	if len(subDirs) > 0 {
+		dirScanner.mutex.Lock()
+		dirScanner.jobs = append(dirScanner.jobs, subDirs...)
+		dirScanner.mutex.Unlock()
+		dirScanner.cond.Broadcast()
+	}
+}
+
+// Add a subdirectory into the tree, and return the waiting list with it (mount points and directories beyond the maximum depth are not added to the waiting list)
+//	- job: parent directory being read
+//	- info: subdirectory's informations returned by Lstat
+//	- cached: same subdirectory into the previous scan, nil if not found
+//	- linkTarget: target of the followed symbolic link the subdirectory was reached through (empty if none)
+//	- subDirs: waiting list of the parent directory's subdirectories
+//	- readCounters: counters of the parent directory
+func (dirScanner *scanner) addDir(job dirJob, info os.FileInfo, cached *usData.Node, linkTarget string, subDirs []dirJob, readCounters *ScanCounters) []dirJob {
+	node := &usData.Node{Name: info.Name(), IsDir: true, Mode: info.Mode(), ModTime: info.ModTime(), Links: uint64(1), LinkTarget: linkTarget}
+	node.DiskSize, _ = diskSize(info) // Blocks of the directory itself, like du (its apparent size is not counted)
+	node.Device, node.Inode, _, _ = inodeInfo(info)
+	readCounters.Dirs++
+
+	// Already counted through a followed symbolic link (by this scan or a previous one): keep it as a distinct entry, but don't scan it again
+	if job.followed && !dirScanner.dirTree.CountFollowed(node) {
+		node.IsLinkDuplicate = true
+		dirScanner.dirTree.AddChild(job.dirNode, node)
+		dirScanner.dirTree.DirDone(node)
+		return subDirs
+	}
+
+	// Mount point: keep it as a distinct entry, but don't scan it
+	if dirScanner.scanOptions.OneFileSystem {
+		if device, ok := deviceID(info); ok && device != dirScanner.rootDevice {
+			node.IsMountPoint = true
+		}
+	}
+
+	dirScanner.dirTree.AddChild(job.dirNode, node)
+	if node.IsMountPoint {
+		dirScanner.dirTree.DirDone(node)
+		return subDirs
+	}
+
+	// Beyond the maximum depth: read when it is expanded
+	if dirScanner.scanOptions.beyondMaxDepth(job.depth + 1) {
+		dirScanner.dirTree.DeferDir(node)
+		return subDirs
+	}
+
+	subDir := dirJob{dirNode: node, fullPath: filepath.Join(job.fullPath, info.Name()), cached: cached, excludes: job.excludes, depth: job.depth + 1}
+	subDir.followed = job.followed || linkTarget != ""
+	if cached != nil {
+		subDir.unchanged = isUnchanged(info, dirScanner.scanOptions.Cache.Stat(cached))
+	}
+	return append(subDirs, subDir)
+}
+
+// Add a file into the tree
+//	- job: parent directory being read
+//	- node: file's node
+//	- readCounters: counters of the parent directory
+func (dirScanner *scanner) addFile(job dirJob, node *usData.Node, readCounters *ScanCounters) {
+
+	// Already counted through a followed symbolic link
+	if job.followed && node.Links <= 1 && !dirScanner.dirTree.CountFollowed(node) {
+		node.IsLinkDuplicate = true
+	}
+
+	// A file with several hard links is counted only through the first path found (see AddChild)
+	dirScanner.dirTree.AddChild(job.dirNode, node)
+
+	readCounters.Files++
+	if !dirScanner.dirTree.Stat(node).IsLinkDuplicate {
+		readCounters.Bytes += node.Size
+	}
+}
+
+// Add a symbolic link into the tree and follow it (see ScanOptions.FollowSymlinks): it gets its target's size, a directory is scanned
+// Dangling links and links into the scanned directory are added as links, targets already counted (loops included) are marked as duplicates
+//	- job: parent directory being read
+//	- info: link's informations returned by Lstat
+//	- subDirs: waiting list of the parent directory's subdirectories
+//	- readCounters: counters of the parent directory
+func (dirScanner *scanner) addLink(job dirJob, info os.FileInfo, subDirs []dirJob, readCounters *ScanCounters) []dirJob {
+	linkPath := filepath.Join(job.fullPath, info.Name())
+	targetInfo, err := os.Stat(linkPath) // Named as the link
+	if err != nil || dirScanner.isInside(linkPath) {
+		dirScanner.addFile(job, fileNode(info), readCounters)
+		return subDirs
+	}
+
+	// The target is added as reached through a followed link: it is counted only once
+	linkTarget, _ := os.Readlink(linkPath)
+	followedJob := job
+	followedJob.followed = true
+	if targetInfo.IsDir() {
+		return dirScanner.addDir(followedJob, targetInfo, nil, linkTarget, subDirs, readCounters)
+	}
+	node := fileNode(targetInfo)
+	node.LinkTarget = linkTarget
+	dirScanner.addFile(followedJob, node, readCounters)
+	return subDirs
+}
+
+// Return true if the target of a symbolic link is inside the scanned directory (it is counted through its own path)
+//	- linkPath: full path of the symbolic link
+func (dirScanner *scanner) isInside(linkPath string) bool {
+	targetPath, err := filepath.EvalSymlinks(linkPath)
+	if err != nil || dirScanner.rootPath == "" {
+		return false
+	}
+	targetPath, _ = filepath.Abs(targetPath)
+	return targetPath == dirScanner.rootPath || strings.HasPrefix(targetPath, strings.TrimSuffix(dirScanner.rootPath, "/")+"/")
+}
+
+// Return exclude rules applied into a directory's content: those of its parents, with those of its ignore file
+// An unreadable ignore file (or an invalid rule into it) is recorded as an error of the directory
+//	- job: directory being read
+//	- readCounters: counters of the directory
+func (dirScanner *scanner) readIgnoreFile(job dirJob, readCounters *ScanCounters) []ExcludeRule {
+	rules, err := ReadExcludeFile(filepath.Join(job.fullPath, IgnoreFileName), job.fullPath)
+	if err != nil {
+		if _, isReadError := err.(*os.PathError); !isReadError {
+			err = fmt.Errorf("%w: %v", usData.ErrInvalidIgnoreFile, err)
+		}
+		dirScanner.dirTree.AddError(job.dirNode, err)
+		readCounters.Errors++
+		return job.excludes
+	}
+	return append(append([]ExcludeRule{}, job.excludes...), rules...)
+}
+
+// Return the node of a file read from the filesystem
+//	- info: file's informations returned by Lstat
+func fileNode(info os.FileInfo) *usData.Node {
+	node := &usData.Node{Name: info.Name(), Mode: info.Mode(), ModTime: info.ModTime(), Size: uint64(info.Size()), Links: uint64(1)}
+
+	var ok bool
+	node.DiskSize, ok = diskSize(info)
+	if !ok {
+		node.DiskSize = node.Size // No blocks information: use apparent size
+	}
+	if device, inode, links, ok := inodeInfo(info); ok {
+		node.Device, node.Inode, node.Links = device, inode, links
+	}
+
+	return node
+}
+
+// Return the node of a file reused from the previous scan
+//	- cachedInfo: copy of the file's node into the previous scan
+func cachedFileNode(cachedInfo usData.Node) *usData.Node {
+	return &usData.Node{
+		Name:     cachedInfo.Name,
+		Mode:     cachedInfo.Mode,
+		ModTime:  cachedInfo.ModTime,
+		Size:     cachedInfo.Size,
+		DiskSize: cachedInfo.DiskSize,
+		Device:   cachedInfo.Device,
+		Inode:    cachedInfo.Inode,
+		Links:    cachedInfo.Links,
+	}
+}
+
+// Return true if a directory was fully read by the previous scan and was not modified since (same mtime, to the second)
+//	- info: directory's informations returned by Lstat
+//	- cachedInfo: copy of the directory's node into the previous scan
+func isUnchanged(info os.FileInfo, cachedInfo usData.Node) bool {
+	if !cachedInfo.IsDir || cachedInfo.IsMountPoint || cachedInfo.IsExcluded || !cachedInfo.Listed || cachedInfo.Err != nil || cachedInfo.ModTime.IsZero() {
+		return false
+	}
+	return info.ModTime().Unix() == cachedInfo.ModTime.Unix()
 }
@@ -0,0 +1,144 @@
+// Check directory scans: targets of followed symbolic links, directories reused from a cached scan
+package usWalk
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	usData "UsedSpace/usData"
+	usExport "UsedSpace/usExport"
+)
+
+// Scan a directory and return its tree once the scan is done
+//	- t: test state
+//	- rootPath: path of the scanned directory
+//	- scanOptions: options used while scanning
+func scanTree(t *testing.T, rootPath string, scanOptions ScanOptions) *usData.DirTree {
+	dirTree := usData.NewDirTree(rootPath)
+	scanState := make(chan bool, 1)
+	WalkGivenDir(context.Background(), rootPath, dirTree, scanOptions, &ScanProgress{}, scanState)
+	<-scanState
+	if !dirTree.Root.ScanDone {
+		t.Fatalf("scan of %s is not done", rootPath)
+	}
+	return dirTree
+}
+
+// Return a scanned tree as it is read back from the cache file (an ncdu dump)
+//	- t: test state
+//	- dirTree: scanned tree
+func cachedTree(t *testing.T, dirTree *usData.DirTree) *usData.DirTree {
+	var dump bytes.Buffer
+	if err := usExport.ExportNcdu(&dump, dirTree); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := usExport.ImportNcdu(&dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestFollowedLinksThroughCache(t *testing.T) {
+	// root/a/l1 and root/a/l2 are symbolic links to the same file, outside the scanned directory
+	tempDir := t.TempDir()
+	rootPath, targetPath := filepath.Join(tempDir, "root"), filepath.Join(tempDir, "big")
+	if err := os.MkdirAll(filepath.Join(rootPath, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(targetPath, make([]byte, 100000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"l1", "l2"} {
+		if err := os.Symlink(targetPath, filepath.Join(rootPath, "a", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Scan, then scan again twice from the previous scan: a/ is not modified, its links are still counted once
+	scanOptions := ScanOptions{FollowSymlinks: true, Jobs: 1}
+	dirTree := scanTree(t, rootPath, scanOptions)
+	for _, step := range []string{"scan", "first cached scan", "second cached scan"} {
+		if dirTree.Root.Size != 100000 {
+			t.Errorf("%s: root size %d, want 100000 (the target counted once)", step, dirTree.Root.Size)
+		}
+		duplicates := 0
+		for _, name := range []string{"l1", "l2"} {
+			link := dirTree.Lookup(filepath.Join(rootPath, "a", name))
+			if link == nil || link.LinkTarget != targetPath {
+				t.Fatalf("%s: a/%s should be a followed link to %s: %+v", step, name, targetPath, link)
+			}
+			if link.IsLinkDuplicate {
+				duplicates++
+			}
+		}
+		if duplicates != 1 {
+			t.Errorf("%s: %d duplicate links, want 1", step, duplicates)
+		}
+
+		scanOptions.Cache = cachedTree(t, dirTree)
+		dirTree = scanTree(t, rootPath, scanOptions)
+	}
+}
+
+func TestScanReusesCache(t *testing.T) {
+	// root/a/f and root/b/g, directories dated in the past (mtimes are compared to the second)
+	rootPath := t.TempDir()
+	for _, name := range []string{"a/f", "b/g"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(rootPath, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(rootPath, name), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a", "b", ""} {
+		if err := os.Chtimes(filepath.Join(rootPath, name), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The cache says a/f has 5000 bytes: a/ is not modified, its cached files are reused
+	cache := cachedTree(t, scanTree(t, rootPath, ScanOptions{}))
+	cachedFile := cache.Lookup(filepath.Join(rootPath, "a", "f"))
+	cache.UpdateFile(cachedFile, 5000, 5000, cache.Stat(cachedFile).ModTime)
+
+	// b/h is created: b/ is modified, it is read again
+	if err := os.WriteFile(filepath.Join(rootPath, "b", "h"), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(rootPath, "b"), past.Add(time.Minute), past.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	dirTree := scanTree(t, rootPath, ScanOptions{Cache: cache})
+	tests := []struct {
+		name string
+		size uint64
+	}{
+		{"a/f", 5000}, // Reused from the cache
+		{"a", 5000},
+		{"b/g", 100},
+		{"b/h", 10}, // Found by reading b/ again
+		{"b", 110},
+		{"", 5110},
+	}
+	for _, test := range tests {
+		node := dirTree.Lookup(filepath.Join(rootPath, test.name))
+		if node == nil {
+			t.Errorf("%s not found", test.name)
+			continue
+		}
+		if node.Size != test.size {
+			t.Errorf("%s size %d, want %d", test.name, node.Size, test.size)
+		}
+	}
+	if dirTree.Root.Files != 3 || dirTree.Root.Dirs != 2 {
+		t.Errorf("%d files, %d dirs, want 3 and 2", dirTree.Root.Files, dirTree.Root.Dirs)
+	}
+}
@@ -0,0 +1,93 @@
+// Watch the scanned tree once the scan is done: changes made by other processes are applied into the tree
+package usWalk
+
+import (
+	"sync"
+
+	usData "UsedSpace/usData"
+)
+
+// Holds the state of a running watcher
+type Watcher struct {
+	dirTree     *usData.DirTree
+	scanOptions ScanOptions
+	changed     chan bool  // Signal that the tree was changed (buffered, changes are merged until they were read)
+	events      sync.Mutex // Held while an event is applied, and while a directory is read again (see Pause)
+
+	mutex       sync.Mutex
+	fd          int                    // Kernel notification handle (inotify on Linux)
+	watches     map[int32]*usData.Node // Watched directories by watch descriptor
+	watchedDirs map[*usData.Node]int32
+	ignoreRules map[*usData.Node][]ExcludeRule // Parsed rules of ignore files by directory (nil if it has none), read again when they change
+	err         error                          // Last error: some changes are missed (watch limit reached, events lost, ...)
+}
+
+// Return the channel signaling that the tree was changed
+func (watcher *Watcher) Changed() <-chan bool {
+	return watcher.changed
+}
+
+// Return the number of watched directories
+func (watcher *Watcher) Watched() int {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	return len(watcher.watches)
+}
+
+// Return the last error, after which some changes are missed (nil if none)
+func (watcher *Watcher) Err() error {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	return watcher.err
+}
+
+// Record an error after which some changes are missed
+//	- err: error to record
+func (watcher *Watcher) setErr(err error) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	watcher.err = err
+}
+
+// Return exclude rules applied into a directory's content (see dirExcludes), ignore files being parsed only once until they change
+//	- dirNode: directory's node
+func (watcher *Watcher) dirExcludes(dirNode *usData.Node) []ExcludeRule {
+	return inheritedExcludes(watcher.dirTree, dirNode, watcher.scanOptions, watcher.ignoreFileRules)
+}
+
+// Return the rules of the ignore file of a directory, nil if it has none, parsed again only after it changed (see forgetIgnoreRules)
+//	- dirNode: directory's node
+func (watcher *Watcher) ignoreFileRules(dirNode *usData.Node) []ExcludeRule {
+	watcher.mutex.Lock()
+	rules, ok := watcher.ignoreRules[dirNode]
+	watcher.mutex.Unlock()
+	if ok {
+		return rules
+	}
+
+	rules = ignoreFileRules(watcher.dirTree, dirNode)
+	watcher.mutex.Lock()
+	watcher.ignoreRules[dirNode] = rules
+	watcher.mutex.Unlock()
+	return rules
+}
+
+// Forget the parsed rules of the ignore file of a directory: it was created, modified or removed, or the directory is not watched anymore
+//	- dirNode: directory's node
+func (watcher *Watcher) forgetIgnoreRules(dirNode *usData.Node) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	delete(watcher.ignoreRules, dirNode)
+}
+
+// Signal that the tree was changed, without waiting for the signal to be read
+func (watcher *Watcher) notify() {
+	select {
+	case watcher.changed <- true:
+	default: // A change is already signaled
+	}
+}
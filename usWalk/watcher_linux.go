@@ -0,0 +1,278 @@
+//go:build linux
+// +build linux
+
+// Watch the scanned tree with inotify: created, modified, deleted and moved files/directories are applied into the tree
+package usWalk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	usData "UsedSpace/usData"
+)
+
+// Events watched on each directory
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW | syscall.IN_EXCL_UNLINK
+
+// Create a watcher and watch all scanned directories (mount points excepted)
+//	- dirTree: holds informations about scanned file/directory
+//	- scanOptions: options used to scan new directories
+func NewWatcher(dirTree *usData.DirTree, scanOptions ScanOptions) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	scanOptions.Cache = nil // New directories are always read
+	watcher := &Watcher{
+		dirTree:     dirTree,
+		scanOptions: scanOptions,
+		changed:     make(chan bool, 1),
+		fd:          fd,
+		watches:     make(map[int32]*usData.Node),
+		watchedDirs: make(map[*usData.Node]int32),
+		ignoreRules: make(map[*usData.Node][]ExcludeRule),
+	}
+	watcher.addWatches(dirTree.Root, dirTree.FullPath(dirTree.Root))
+
+	return watcher, nil
+}
+
+// Read events and apply them into the tree, until the watcher fails
+func (watcher *Watcher) Run() {
+	buffer := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(watcher.fd, buffer)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			watcher.setErr(err)
+			watcher.notify()
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buffer[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			watcher.handleEvent(event.Wd, event.Mask, name)
+		}
+	}
+}
+
+// Watch a directory and all its subdirectories
+//	- dirNode: directory's node
+//	- fullPath: full path of the directory
+func (watcher *Watcher) addWatches(dirNode *usData.Node, fullPath string) {
+	dirInfo := watcher.dirTree.Stat(dirNode)
+	if dirInfo.IsMountPoint || dirInfo.IsExcluded || dirInfo.IsDeferred || dirInfo.LinkTarget != "" {
+		return
+	}
+
+	wd, err := syscall.InotifyAddWatch(watcher.fd, fullPath, watchMask)
+	if err == syscall.ENOSPC {
+		watcher.setErr(errors.New("inotify watch limit reached (fs.inotify.max_user_watches), some directories are not watched"))
+		return
+	}
+	if err == nil {
+		watcher.mutex.Lock()
+		watcher.watches[int32(wd)] = dirNode
+		watcher.watchedDirs[dirNode] = int32(wd)
+		watcher.mutex.Unlock()
+	}
+
+	for _, child := range watcher.dirTree.Children(dirNode) {
+		if child.IsDir {
+			watcher.addWatches(child, filepath.Join(fullPath, child.Name))
+		}
+	}
+}
+
+// Stop watching a directory and all its subdirectories
+//	- dirNode: directory's node
+func (watcher *Watcher) removeWatches(dirNode *usData.Node) {
+	watcher.mutex.Lock()
+	if wd, ok := watcher.watchedDirs[dirNode]; ok {
+		syscall.InotifyRmWatch(watcher.fd, uint32(wd))
+		delete(watcher.watches, wd)
+		delete(watcher.watchedDirs, dirNode)
+	}
+	delete(watcher.ignoreRules, dirNode)
+	watcher.mutex.Unlock()
+
+	for _, child := range watcher.dirTree.Children(dirNode) {
+		if child.IsDir {
+			watcher.removeWatches(child)
+		}
+	}
+}
+
+// Stop applying events before a directory is read again (see RescanDir): they wait into the kernel queue until Rewatch is called
+// Events are applied in order once the directory was read and watched again, none is applied to a directory being replaced
+func (watcher *Watcher) Pause() {
+	watcher.events.Lock()
+}
+
+// Watch again a directory read again (see RescanDir), then apply events received meanwhile (see Pause)
+// Subdirectories still there keep their watch (the same directory returns the same watch descriptor), the removed ones are not watched anymore
+//	- dirNode: directory's node
+func (watcher *Watcher) Rewatch(dirNode *usData.Node) {
+	defer watcher.events.Unlock()
+
+	watcher.addWatches(dirNode, watcher.dirTree.FullPath(dirNode))
+
+	watcher.mutex.Lock()
+	for node, wd := range watcher.watchedDirs {
+		if watcher.dirTree.Contains(node) {
+			continue
+		}
+		delete(watcher.watchedDirs, node)
+		if watcher.watches[wd] == node { // Not moved to the node of the same directory read again
+			syscall.InotifyRmWatch(watcher.fd, uint32(wd))
+			delete(watcher.watches, wd)
+		}
+	}
+	for node := range watcher.ignoreRules {
+		if node == dirNode || !watcher.dirTree.Contains(node) {
+			delete(watcher.ignoreRules, node)
+		}
+	}
+	watcher.mutex.Unlock()
+
+	watcher.notify()
+}
+
+// Apply an event into the tree
+//	- wd: watch descriptor of the directory holding the changed file/directory
+//	- mask: kind of event
+//	- name: base name of the changed file/directory
+func (watcher *Watcher) handleEvent(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		watcher.setErr(errors.New("too many changes at once, some of them were missed (sizes may be outdated)"))
+		watcher.notify()
+		return
+	}
+
+	watcher.events.Lock()
+	defer watcher.events.Unlock()
+
+	watcher.mutex.Lock()
+	dirNode := watcher.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 { // The directory was deleted, or is not watched anymore
+		delete(watcher.watches, wd)
+		delete(watcher.watchedDirs, dirNode)
+		dirNode = nil
+	}
+	watcher.mutex.Unlock()
+	if dirNode == nil || name == "" || !watcher.dirTree.Contains(dirNode) { // Replaced by a directory read again, not watched anymore
+		return
+	}
+
+	// Rules of a changed ignore file are parsed again when they are needed
+	if name == IgnoreFileName {
+		watcher.forgetIgnoreRules(dirNode)
+	}
+
+	fullPath := filepath.Join(watcher.dirTree.FullPath(dirNode), name)
+	child := watcher.dirTree.Child(dirNode, name)
+	switch {
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		if child != nil {
+			watcher.removeNode(child, mask&syscall.IN_DELETE != 0) // A moved file/directory still exists elsewhere
+		}
+
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		info, err := os.Lstat(fullPath)
+		if child != nil && err == nil && watcher.isSameFile(child, info) {
+			watcher.updateNode(child, info) // Already added (by the directory read again while events were paused)
+			break
+		}
+		if child != nil {
+			watcher.removeNode(child, true) // Replaced by the new one
+		}
+		if err == nil {
+			watcher.addNode(dirNode, info, fullPath)
+		}
+
+	case mask&syscall.IN_MODIFY != 0:
+		if child == nil || child.IsDir || child.IsExcluded {
+			return
+		}
+		if info, err := os.Lstat(fullPath); err == nil {
+			watcher.updateNode(child, info)
+		}
+	}
+
+	watcher.notify()
+}
+
+// Add a created file/directory into the tree, a directory is scanned then watched (unless it is excluded)
+//	- dirNode: parent directory's node
+//	- info: file/directory's informations returned by Lstat
+//	- fullPath: full path of the file/directory
+func (watcher *Watcher) addNode(dirNode *usData.Node, info os.FileInfo, fullPath string) {
+	excludes := watcher.dirExcludes(dirNode)
+	if isExcluded(excludes, fullPath, info.IsDir()) {
+		addExcluded(watcher.dirTree, dirNode, usData.Node{Name: info.Name(), IsDir: info.IsDir(), Mode: info.Mode(), ModTime: info.ModTime()}, watcher.scanOptions)
+		return
+	}
+	if !info.IsDir() {
+		watcher.dirTree.AddChild(dirNode, fileNode(info))
+		return
+	}
+
+	node := &usData.Node{Name: info.Name(), IsDir: true, Mode: info.Mode(), ModTime: info.ModTime(), Links: uint64(1)}
+	node.DiskSize, _ = diskSize(info)
+	node.Device, node.Inode, _, _ = inodeInfo(info)
+	watcher.dirTree.AddChild(dirNode, node)
+	depth := watcher.dirTree.Depth(node)
+	if watcher.scanOptions.beyondMaxDepth(depth) {
+		watcher.dirTree.DeferDir(node) // Read (and watched) when it is expanded
+		return
+	}
+	scanDirs(context.Background(), []dirJob{{dirNode: node, fullPath: fullPath, excludes: excludes, depth: depth}}, watcher.dirTree, watcher.scanOptions, &ScanProgress{})
+	watcher.addWatches(node, fullPath)
+}
+
+// Update the sizes of a modified file (directories sizes are the sum of their children)
+//	- node: file/directory's node
+//	- info: file/directory's informations returned by Lstat
+func (watcher *Watcher) updateNode(node *usData.Node, info os.FileInfo) {
+	if info.IsDir() || watcher.dirTree.Stat(node).IsExcluded {
+		return
+	}
+	updated := fileNode(info)
+	watcher.dirTree.UpdateFile(node, updated.Size, updated.DiskSize, updated.ModTime)
+}
+
+// Return true if a node of the tree is the given file/directory (same device and inode)
+//	- node: file/directory's node
+//	- info: file/directory's informations returned by Lstat
+func (watcher *Watcher) isSameFile(node *usData.Node, info os.FileInfo) bool {
+	nodeInfo := watcher.dirTree.Stat(node)
+	device, inode, _, ok := inodeInfo(info)
+	return ok && nodeInfo.Inode != 0 && nodeInfo.Device == device && nodeInfo.Inode == inode && nodeInfo.IsDir == info.IsDir()
+}
+
+// Remove a deleted (or moved) file/directory from the tree, and stop watching it
+//	- node: file/directory's node
+//	- deleted: the file/directory was deleted, else it was moved (its hard linked files keep their number of links)
+func (watcher *Watcher) removeNode(node *usData.Node, deleted bool) {
+	if node.IsDir {
+		watcher.removeWatches(node)
+	}
+	if deleted {
+		watcher.dirTree.Remove(node)
+	} else {
+		watcher.dirTree.Detach(node)
+	}
+}
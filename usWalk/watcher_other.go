@@ -0,0 +1,31 @@
+//go:build !linux
+// +build !linux
+
+// Watching the scanned tree is not available on this system
+package usWalk
+
+import (
+	"errors"
+
+	usData "UsedSpace/usData"
+)
+
+// Return an error: watching the scanned tree needs inotify (Linux)
+//	- dirTree: holds informations about scanned file/directory
+//	- scanOptions: options used to scan new directories
+func NewWatcher(dirTree *usData.DirTree, scanOptions ScanOptions) (*Watcher, error) {
+	return nil, errors.New("watching for changes is only available on Linux")
+}
+
+// Do nothing: watching the scanned tree is not available on this system
+func (watcher *Watcher) Run() {
+}
+
+// Do nothing: watching the scanned tree is not available on this system
+func (watcher *Watcher) Pause() {
+}
+
+// Do nothing: watching the scanned tree is not available on this system
+//	- dirNode: directory's node
+func (watcher *Watcher) Rewatch(dirNode *usData.Node) {
+}